@@ -2,15 +2,27 @@ package httplog
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"time"
 )
 
 // Audit struct can be included as part of an http response body.
 // This struct sends back the Unique ID generated upon receiving a
-// request as well as echoes back the URL information to help with
-// debugging.
+// request as well as echoes back the method, URL information and
+// timing to help with debugging.
 type Audit struct {
 	RequestID string   `json:"id"`
+	Method    string   `json:"method,omitempty"`
 	URL       AuditURL `json:"url,omitempty"`
+	// Received is the time the request was received. It is nil, and
+	// left out of the JSON, if the request did not come through the
+	// middleware
+	Received *time.Time `json:"received,omitempty"`
+	// ElapsedMillis is the time in milliseconds from the request
+	// being received to the Audit being created. Like Received, it
+	// is nil if the receive time is not known
+	ElapsedMillis *float64 `json:"elapsed_ms,omitempty"`
 }
 
 // AuditURL has URL info which can be included as part of an http response body
@@ -56,7 +68,54 @@ func NewAudit(ctx context.Context) (*Audit, error) {
 		aurl.RequestRawQuery = rrq
 	}
 
+	frag, err := RequestFragment(ctx)
+	if err == nil {
+		aurl.RequestFragment = frag
+	}
+
 	audit.URL = aurl
 
+	if ri, ok := FromContext(ctx); ok {
+		audit.Method = ri.Method
+		if !ri.Received.IsZero() {
+			since := ri.received
+			if since.IsZero() {
+				since = ri.Received
+			}
+			received := ri.Received
+			elapsed := float64(time.Since(since)) / float64(time.Millisecond)
+			audit.Received = &received
+			audit.ElapsedMillis = &elapsed
+		}
+	}
+
 	return audit, nil
 }
+
+// Envelope is the standard response body written by WriteJSON,
+// holding the Audit for the request alongside the payload
+type Envelope struct {
+	Audit *Audit      `json:"audit"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// WriteJSON writes payload as the JSON response body, wrapped in an
+// Envelope with the Audit built from ctx, and sets the status code
+// and Content-Type header.
+func WriteJSON(w http.ResponseWriter, ctx context.Context, status int, payload interface{}) error {
+	aud, err := NewAudit(ctx)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(Envelope{Audit: aud, Data: payload})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+
+	return err
+}
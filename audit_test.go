@@ -1,9 +1,14 @@
 package httplog
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewAudit(t *testing.T) {
@@ -12,7 +17,7 @@ func TestNewAudit(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	ctx = context.WithValue(ctx, requestID, "test123")
+	ctx = NewContext(ctx, RequestInfo{ID: "test123"})
 	// ctx = context.WithValue(ctx, requestHost, "testhost")
 
 	arg := args{ctx}
@@ -42,3 +47,89 @@ func TestNewAudit(t *testing.T) {
 		})
 	}
 }
+
+func TestNewAudit_RequestInfo(t *testing.T) {
+	received := time.Now().Add(-50 * time.Millisecond)
+	ctx := NewContext(context.Background(), RequestInfo{
+		ID:       "test123",
+		Method:   http.MethodGet,
+		Host:     "example.com",
+		Port:     "8080",
+		Path:     "/api/v1/user",
+		RawQuery: "a=b",
+		Fragment: "frag",
+		Received: received,
+	})
+
+	got, err := NewAudit(ctx)
+	if err != nil {
+		t.Fatalf("NewAudit() error = %v", err)
+	}
+
+	wantURL := AuditURL{
+		RequestHost:     "example.com",
+		RequestPort:     "8080",
+		RequestPath:     "/api/v1/user",
+		RequestRawQuery: "a=b",
+		RequestFragment: "frag",
+	}
+	if got.URL != wantURL {
+		t.Errorf("NewAudit() URL = %+v, want %+v", got.URL, wantURL)
+	}
+	if got.Method != http.MethodGet {
+		t.Errorf("NewAudit() Method = %q, want %q", got.Method, http.MethodGet)
+	}
+	if got.Received == nil || !got.Received.Equal(received) {
+		t.Errorf("NewAudit() Received = %v, want %v", got.Received, received)
+	}
+	if got.ElapsedMillis == nil || *got.ElapsedMillis < 50 {
+		t.Errorf("NewAudit() ElapsedMillis = %v, want >= 50", got.ElapsedMillis)
+	}
+}
+
+func TestNewAudit_NoReceived(t *testing.T) {
+	ctx := NewContext(context.Background(), RequestInfo{ID: "test123"})
+
+	got, err := NewAudit(ctx)
+	if err != nil {
+		t.Fatalf("NewAudit() error = %v", err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if bytes.Contains(b, []byte("received")) || bytes.Contains(b, []byte("elapsed_ms")) {
+		t.Errorf("Audit JSON = %s, want received and elapsed_ms omitted", b)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	ctx := NewContext(context.Background(), RequestInfo{ID: "test123", Method: http.MethodPost})
+
+	w := httptest.NewRecorder()
+	payload := map[string]string{"username": "repoman"}
+	if err := WriteJSON(w, ctx, http.StatusCreated, payload); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("WriteJSON() status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("WriteJSON() Content-Type = %q, want application/json", ct)
+	}
+
+	var got struct {
+		Audit Audit             `json:"audit"`
+		Data  map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Audit.RequestID != "test123" || got.Audit.Method != http.MethodPost {
+		t.Errorf("WriteJSON() audit = %+v", got.Audit)
+	}
+	if !reflect.DeepEqual(got.Data, payload) {
+		t.Errorf("WriteJSON() data = %v, want %v", got.Data, payload)
+	}
+}
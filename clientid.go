@@ -0,0 +1,291 @@
+package httplog
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxClientIDLen is the size of the client_id column of the
+// audit_log table, in characters
+const maxClientIDLen = 100
+
+// jwtLeeway is the clock skew allowed when checking the exp and nbf
+// claims of a JWT
+const jwtLeeway = time.Minute
+
+// ClientIdentifier resolves the id of the API client which sent a
+// request. If set in Opts, it is called for each request by the
+// middleware and the resulting id is set into the RequestInfo in
+// the context, written to the logs and stored in the client_id
+// column of the audit_log table. ClientID should return an empty
+// string and a nil error if the request does not identify a client.
+// An id longer than 100 characters, the size of the client_id
+// column, is logged and ignored.
+type ClientIdentifier interface {
+	ClientID(req *http.Request) (string, error)
+}
+
+// ClientIdentifierFunc is an adapter to allow the use of an
+// ordinary function as a ClientIdentifier
+type ClientIdentifierFunc func(req *http.Request) (string, error)
+
+// ClientID calls f(req)
+func (f ClientIdentifierFunc) ClientID(req *http.Request) (string, error) {
+	return f(req)
+}
+
+// ClientIdentifiers returns a ClientIdentifier which tries each of
+// ids in order and returns the first non-empty client id. An error
+// from any of ids stops the search and is returned.
+func ClientIdentifiers(ids ...ClientIdentifier) ClientIdentifier {
+	return ClientIdentifierFunc(func(req *http.Request) (string, error) {
+		for _, id := range ids {
+			cid, err := id.ClientID(req)
+			if err != nil {
+				return "", err
+			}
+			if cid != "" {
+				return cid, nil
+			}
+		}
+		return "", nil
+	})
+}
+
+// APIKeyClientIdentifier returns a ClientIdentifier which reads an
+// API key from the given request header and passes it to lookup to
+// find the client id. The API key itself is never used as the
+// client id, so it does not end up in logs.
+func APIKeyClientIdentifier(header string, lookup func(apiKey string) (clientID string, ok bool)) ClientIdentifier {
+	return ClientIdentifierFunc(func(req *http.Request) (string, error) {
+		key := req.Header.Get(header)
+		if key == "" {
+			return "", nil
+		}
+		cid, ok := lookup(key)
+		if !ok {
+			return "", errors.Errorf("unknown API key in %s header", header)
+		}
+		return cid, nil
+	})
+}
+
+// BasicAuthClientIdentifier returns a ClientIdentifier which uses
+// the username of the request's HTTP Basic Authorization header.
+// The password is not checked.
+func BasicAuthClientIdentifier() ClientIdentifier {
+	return ClientIdentifierFunc(func(req *http.Request) (string, error) {
+		username, _, ok := req.BasicAuth()
+		if !ok {
+			return "", nil
+		}
+		return username, nil
+	})
+}
+
+// ClientCertIdentifier returns a ClientIdentifier which uses the
+// TLS client certificate presented by the caller (mutual TLS). The
+// subject Common Name is used, unless san is true, in which case
+// the first Subject Alternative Name is used (URI, then DNS name,
+// then email address). The certificate is expected to have been
+// verified by the server's tls.Config.
+func ClientCertIdentifier(san bool) ClientIdentifier {
+	return ClientIdentifierFunc(func(req *http.Request) (string, error) {
+		if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+			return "", nil
+		}
+		cert := req.TLS.PeerCertificates[0]
+		if !san {
+			return cert.Subject.CommonName, nil
+		}
+		switch {
+		case len(cert.URIs) > 0:
+			return cert.URIs[0].String(), nil
+		case len(cert.DNSNames) > 0:
+			return cert.DNSNames[0], nil
+		case len(cert.EmailAddresses) > 0:
+			return cert.EmailAddresses[0], nil
+		}
+		return "", nil
+	})
+}
+
+// JWTKeySource returns the key used to verify the signature of a
+// JWT, given the kid and alg from the token header. The key must be
+// a []byte for HMAC algorithms (HS256, HS384, HS512), an
+// *rsa.PublicKey for RS256, RS384 and RS512 or an *ecdsa.PublicKey
+// for ES256, ES384 and ES512.
+type JWTKeySource interface {
+	JWTKey(kid, alg string) (interface{}, error)
+}
+
+// JWTKeySourceFunc is an adapter to allow the use of an ordinary
+// function as a JWTKeySource
+type JWTKeySourceFunc func(kid, alg string) (interface{}, error)
+
+// JWTKey calls f(kid, alg)
+func (f JWTKeySourceFunc) JWTKey(kid, alg string) (interface{}, error) {
+	return f(kid, alg)
+}
+
+// JWTClientIdentifier returns a ClientIdentifier which reads a JWT
+// from the request's "Authorization: Bearer" header and uses the
+// given claim as the client id. If claim is empty, the azp claim is
+// used, falling back to sub.
+//
+// If keys is nil the token signature is not verified, which is
+// only appropriate when the token has already been verified, for
+// example by an API gateway in front of the service. Otherwise the
+// signature is verified with the key returned by keys, and tokens
+// which are expired (exp) or not yet valid (nbf) are rejected,
+// allowing a minute of clock skew.
+func JWTClientIdentifier(claim string, keys JWTKeySource) ClientIdentifier {
+	return ClientIdentifierFunc(func(req *http.Request) (string, error) {
+		const prefix = "bearer "
+		auth := req.Header.Get("Authorization")
+		if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+			return "", nil
+		}
+
+		claims, err := parseJWT(strings.TrimSpace(auth[len(prefix):]), keys)
+		if err != nil {
+			return "", err
+		}
+
+		if claim != "" {
+			cid, _ := claims[claim].(string)
+			return cid, nil
+		}
+		if azp, _ := claims["azp"].(string); azp != "" {
+			return azp, nil
+		}
+		sub, _ := claims["sub"].(string)
+		return sub, nil
+	})
+}
+
+// parseJWT decodes the claims of a compact serialized JWT. If keys
+// is not nil, the signature and the exp and nbf claims are verified
+func parseJWT(token string, keys JWTKeySource) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &hdr); err != nil {
+		return nil, errors.Wrap(err, "malformed JWT header")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, "malformed JWT claims")
+	}
+
+	if keys == nil {
+		return claims, nil
+	}
+
+	key, err := keys.JWTKey(hdr.Kid, hdr.Alg)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed JWT signature")
+	}
+	if err := verifyJWT(hdr.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && !now.Add(-jwtLeeway).Before(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("JWT is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("JWT is not valid yet")
+	}
+
+	return claims, nil
+}
+
+func decodeJWTSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifyJWT verifies the signature of signed using alg and key
+func verifyJWT(alg string, key interface{}, signed string, sig []byte) error {
+	var h crypto.Hash
+	switch alg {
+	case "HS256", "RS256", "ES256":
+		h = crypto.SHA256
+	case "HS384", "RS384", "ES384":
+		h = crypto.SHA384
+	case "HS512", "RS512", "ES512":
+		h = crypto.SHA512
+	default:
+		return errors.Errorf("unsupported JWT alg %q", alg)
+	}
+
+	switch alg[:2] {
+	case "HS":
+		k, ok := key.([]byte)
+		if !ok {
+			return errors.Errorf("JWT alg %s requires a []byte key", alg)
+		}
+		mac := hmac.New(h.New, k)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return errors.New("invalid JWT signature")
+		}
+		return nil
+	}
+
+	hasher := h.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.Errorf("JWT alg %s requires an *rsa.PublicKey", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, h, digest, sig); err != nil {
+			return errors.New("invalid JWT signature")
+		}
+		return nil
+	default: // ES
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.Errorf("JWT alg %s requires an *ecdsa.PublicKey", alg)
+		}
+		// the signature is r and s concatenated, each the size of the curve
+		if len(sig)%2 != 0 {
+			return errors.New("invalid JWT signature")
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid JWT signature")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package httplog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// hs256JWT returns a JWT with the given claims signed with key
+func hs256JWT(claims string, key []byte) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestClientIdentifiers(t *testing.T) {
+	key := []byte("secret")
+	keys := JWTKeySourceFunc(func(kid, alg string) (interface{}, error) {
+		if alg != "HS256" {
+			return nil, errors.New("unexpected alg")
+		}
+		return key, nil
+	})
+
+	lookup := func(apiKey string) (string, bool) {
+		if apiKey == "k-123" {
+			return "client-123", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name    string
+		ci      ClientIdentifier
+		header  string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"api key", APIKeyClientIdentifier("X-API-Key", lookup), "X-API-Key", "k-123", "client-123", false},
+		{"unknown api key", APIKeyClientIdentifier("X-API-Key", lookup), "X-API-Key", "nope", "", true},
+		{"no api key", APIKeyClientIdentifier("X-API-Key", lookup), "X-Other", "k-123", "", false},
+		{"basic auth", BasicAuthClientIdentifier(), "Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte("otto:pw")), "otto", false},
+		{"jwt azp", JWTClientIdentifier("", nil), "Authorization", "Bearer " + hs256JWT(`{"sub":"user1","azp":"app1"}`, key), "app1", false},
+		{"jwt sub", JWTClientIdentifier("", nil), "Authorization", "Bearer " + hs256JWT(`{"sub":"user1"}`, key), "user1", false},
+		{"jwt named claim", JWTClientIdentifier("sub", nil), "Authorization", "Bearer " + hs256JWT(`{"sub":"user1","azp":"app1"}`, key), "user1", false},
+		{"jwt verified", JWTClientIdentifier("", keys), "Authorization", "Bearer " + hs256JWT(`{"sub":"user1"}`, key), "user1", false},
+		{"jwt bad signature", JWTClientIdentifier("", keys), "Authorization", "Bearer " + hs256JWT(`{"sub":"user1"}`, []byte("wrong")), "", true},
+		{"jwt expired", JWTClientIdentifier("", keys), "Authorization", "Bearer " + hs256JWT(`{"sub":"user1","exp":1}`, key), "", true},
+		{"jwt expired within leeway", JWTClientIdentifier("", keys), "Authorization", "Bearer " + hs256JWT(fmt.Sprintf(`{"sub":"user1","exp":%d}`, time.Now().Add(-10*time.Second).Unix()), key), "user1", false},
+		{"jwt not yet valid", JWTClientIdentifier("", keys), "Authorization", "Bearer " + hs256JWT(fmt.Sprintf(`{"sub":"user1","nbf":%d}`, time.Now().Add(time.Hour).Unix()), key), "", true},
+		{"jwt nbf within leeway", JWTClientIdentifier("", keys), "Authorization", "Bearer " + hs256JWT(fmt.Sprintf(`{"sub":"user1","nbf":%d}`, time.Now().Add(10*time.Second).Unix()), key), "user1", false},
+		{"jwt malformed", JWTClientIdentifier("", nil), "Authorization", "Bearer abc", "", true},
+		{"first of many", ClientIdentifiers(APIKeyClientIdentifier("X-API-Key", lookup), BasicAuthClientIdentifier()), "Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte("otto:pw")), "otto", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+			req.Header.Set(tt.header, tt.value)
+			got, err := tt.ci.ClientID(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ClientID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ClientID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientCertIdentifier(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://example.com/foo", nil)
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{
+			Subject:  pkix.Name{CommonName: "billing-service"},
+			DNSNames: []string{"billing.internal"},
+		}},
+	}
+
+	if got, _ := ClientCertIdentifier(false).ClientID(req); got != "billing-service" {
+		t.Errorf("ClientCertIdentifier(false) = %q, want billing-service", got)
+	}
+	if got, _ := ClientCertIdentifier(true).ClientID(req); got != "billing.internal" {
+		t.Errorf("ClientCertIdentifier(true) = %q, want billing.internal", got)
+	}
+}
+
+func Test_newAPIAudit_ClientIdentifier(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com:8080/foo", nil)
+	req.SetBasicAuth("otto", "pw")
+
+	opts := new(Opts)
+	opts.Option(IdentifyClient(BasicAuthClientIdentifier()))
+
+	_, aud, err := newAPIAudit(req.Context(), zerolog.Nop(), req, opts, nil)
+	if err != nil {
+		t.Fatalf("newAPIAudit() error = %v", err)
+	}
+	ctx := setRequest2Context(req.Context(), zerolog.Nop(), aud)
+
+	if aud.clientID != "otto" {
+		t.Errorf("tracker clientID = %q, want otto", aud.clientID)
+	}
+	if ri, _ := FromContext(ctx); ri.ClientID != "otto" {
+		t.Errorf("RequestInfo.ClientID = %q, want otto", ri.ClientID)
+	}
+
+	// a client id too long for the client_id column is ignored
+	req.SetBasicAuth(strings.Repeat("x", maxClientIDLen+1), "pw")
+	_, aud, err = newAPIAudit(req.Context(), zerolog.Nop(), req, opts, nil)
+	if err != nil {
+		t.Fatalf("newAPIAudit() error = %v", err)
+	}
+	if aud.clientID != "" {
+		t.Errorf("tracker clientID = %q, want it ignored", aud.clientID)
+	}
+}
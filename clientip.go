@@ -0,0 +1,251 @@
+package httplog
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// forwarded holds the details a proxy passes on about the request
+// it forwarded
+type forwarded struct {
+	clientIP string
+	proto    string
+	host     string
+}
+
+// parseTrustedProxies parses the CIDRs (or single IP addresses) of
+// the proxies trusted to set forwarding headers
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, errors.Errorf("invalid trusted proxy %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy %q", p)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// isTrusted reports whether addr is an IP address within one of the
+// trusted networks
+func isTrusted(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedProxies parses the TrustedProxies set in opts. It is called
+// once when the middleware is built and panics if any of them is not
+// a valid CIDR or IP address, so a bad configuration is caught at
+// startup rather than silently ignored on every request
+func trustedProxies(opts *Opts) []*net.IPNet {
+	if opts == nil || len(opts.TrustedProxies) == 0 {
+		return nil
+	}
+	trusted, err := parseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		panic("httplog: " + err.Error())
+	}
+	return trusted
+}
+
+// hop is a single forwarded address along with the protocol and host
+// the proxy that recorded it received
+type hop struct {
+	ip    string
+	proto string
+	host  string
+}
+
+// resolveForwarded determines the real client IP address, and the
+// protocol and host the client used, for a request which may have
+// passed through one or more proxies. Forwarding headers are only
+// believed if the request was sent by a trusted proxy: the RFC 7239
+// Forwarded header is used if present, otherwise X-Forwarded-For,
+// X-Forwarded-Proto and X-Forwarded-Host, and X-Real-IP as a last
+// resort. The chain of forwarded addresses is walked from the
+// nearest proxy back towards the client and the first address that
+// is not a trusted proxy is the client IP. The protocol and host are
+// taken from the same hop as the client IP, so values a client adds
+// in front of those set by the proxies are never used.
+func resolveForwarded(req *http.Request, trusted []*net.IPNet) forwarded {
+	socketIP := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		socketIP = host
+	}
+
+	f := forwarded{clientIP: socketIP}
+	if !isTrusted(socketIP, trusted) {
+		return f
+	}
+
+	var chain []hop
+	if fwd := req.Header.Values("Forwarded"); len(fwd) > 0 {
+		for _, elem := range parseForwardedHeader(fwd) {
+			v, ok := elem["for"]
+			if !ok {
+				continue
+			}
+			chain = append(chain, hop{
+				ip:    forwardedNodeIP(v),
+				proto: strings.ToLower(elem["proto"]),
+				host:  elem["host"],
+			})
+		}
+	} else {
+		for _, xff := range req.Header.Values("X-Forwarded-For") {
+			for _, addr := range strings.Split(xff, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					chain = append(chain, hop{ip: forwardedNodeIP(addr)})
+				}
+			}
+		}
+		protos := listValues(req.Header.Values("X-Forwarded-Proto"))
+		hosts := listValues(req.Header.Values("X-Forwarded-Host"))
+		if len(chain) == 0 {
+			f.proto = strings.ToLower(hopValue(protos, 0, 1))
+			f.host = hopValue(hosts, 0, 1)
+		}
+		for i := range chain {
+			chain[i].proto = strings.ToLower(hopValue(protos, i, len(chain)))
+			chain[i].host = hopValue(hosts, i, len(chain))
+		}
+	}
+
+	if len(chain) == 0 {
+		if xri := strings.TrimSpace(req.Header.Get("X-Real-IP")); xri != "" {
+			f.clientIP = forwardedNodeIP(xri)
+		}
+		return f
+	}
+
+	// walk back from the nearest proxy; if every address is a
+	// trusted proxy, the furthest one is the client
+	client := chain[0]
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !isTrusted(chain[i].ip, trusted) {
+			client = chain[i]
+			break
+		}
+	}
+
+	f.clientIP = client.ip
+	f.proto = client.proto
+	f.host = client.host
+
+	return f
+}
+
+// hopValue returns the X-Forwarded-Proto or X-Forwarded-Host value
+// for hop i of n forwarded addresses. Each proxy appends to these
+// headers as it does to X-Forwarded-For, so the values are lined up
+// with the addresses from the nearest proxy back. If there are fewer
+// values than addresses, not every proxy set the header and the
+// value set nearest to the server is used
+func hopValue(values []string, i, n int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	if j := len(values) - (n - i); j >= 0 {
+		return values[j]
+	}
+	return values[len(values)-1]
+}
+
+// listValues splits the values of a comma separated list header
+func listValues(headers []string) []string {
+	var values []string
+	for _, h := range headers {
+		for _, v := range strings.Split(h, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// parseForwardedHeader parses the values of RFC 7239 Forwarded
+// headers into a list of elements, each a map of lower cased
+// parameter names to unquoted values
+func parseForwardedHeader(values []string) []map[string]string {
+	var elems []map[string]string
+	for _, v := range values {
+		for _, e := range splitQuoted(v, ',') {
+			elem := make(map[string]string)
+			for _, pair := range splitQuoted(e, ';') {
+				i := strings.Index(pair, "=")
+				if i < 0 {
+					continue
+				}
+				name := strings.ToLower(strings.TrimSpace(pair[:i]))
+				val := strings.TrimSpace(pair[i+1:])
+				if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+					val = strings.ReplaceAll(val[1:len(val)-1], `\"`, `"`)
+				}
+				elem[name] = val
+			}
+			if len(elem) > 0 {
+				elems = append(elems, elem)
+			}
+		}
+	}
+	return elems
+}
+
+// splitQuoted splits s at each sep which is not inside a quoted string
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// forwardedNodeIP strips the port (and IPv6 brackets) from a
+// forwarded node. Nodes that are not IP addresses, such as "unknown"
+// or obfuscated identifiers, are returned unchanged
+func forwardedNodeIP(node string) string {
+	node = strings.TrimSpace(node)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+}
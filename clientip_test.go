@@ -0,0 +1,85 @@
+package httplog
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func Test_resolveForwarded(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       forwarded
+	}{
+		{"direct", "203.0.113.9:5000", nil, forwarded{clientIP: "203.0.113.9"}},
+		{"untrusted sender ignores headers", "203.0.113.9:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			forwarded{clientIP: "203.0.113.9"}},
+		{"x-forwarded-for", "10.1.1.1:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.7, 10.2.2.2", "X-Forwarded-Proto": "HTTPS", "X-Forwarded-Host": "api.example.com"},
+			forwarded{clientIP: "198.51.100.7", proto: "https", host: "api.example.com"}},
+		{"spoofed x-forwarded-for", "10.1.1.1:5000",
+			map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7"},
+			forwarded{clientIP: "198.51.100.7"}},
+		{"all trusted", "10.1.1.1:5000",
+			map[string]string{"X-Forwarded-For": "10.3.3.3, 10.2.2.2"},
+			forwarded{clientIP: "10.3.3.3"}},
+		{"x-real-ip", "192.0.2.1:5000",
+			map[string]string{"X-Real-IP": "198.51.100.7"},
+			forwarded{clientIP: "198.51.100.7"}},
+		{"forwarded", "10.1.1.1:5000",
+			map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711";proto=https;host=api.example.com, for=10.2.2.2`},
+			forwarded{clientIP: "2001:db8:cafe::17", proto: "https", host: "api.example.com"}},
+		{"forwarded with port", "10.1.1.1:5000",
+			map[string]string{"Forwarded": `for="198.51.100.7:1234"`},
+			forwarded{clientIP: "198.51.100.7"}},
+		{"spoofed forwarded proto and host", "10.1.1.1:5000",
+			map[string]string{"Forwarded": `for=1.1.1.1;proto=http;host=evil.example.com, for=198.51.100.7;proto=https;host=api.example.com`},
+			forwarded{clientIP: "198.51.100.7", proto: "https", host: "api.example.com"}},
+		{"spoofed x-forwarded-proto and host", "10.1.1.1:5000",
+			map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.2.2.2", "X-Forwarded-Proto": "http, https, http", "X-Forwarded-Host": "evil.example.com, api.example.com, internal"},
+			forwarded{clientIP: "198.51.100.7", proto: "https", host: "api.example.com"}},
+		{"forwarded unknown", "10.1.1.1:5000",
+			map[string]string{"Forwarded": `for=unknown`},
+			forwarded{clientIP: "unknown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := resolveForwarded(req, trusted); got != tt.want {
+				t.Errorf("resolveForwarded() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseTrustedProxies(t *testing.T) {
+	if _, err := parseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Error("parseTrustedProxies() error = nil, want error")
+	}
+	if _, err := parseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("parseTrustedProxies() error = nil, want error")
+	}
+}
+
+func TestLogHandler_InvalidTrustedProxy(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("LogHandler() did not panic for an invalid trusted proxy")
+		}
+	}()
+	opts := &Opts{TrustedProxies: []string{"10.0.0.0/33"}}
+	LogHandler(zerolog.Nop(), nil, opts)
+}
@@ -2,9 +2,13 @@ package httplog
 
 import (
 	"context"
-	"github.com/pkg/errors"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/gilcrest/httplog/errs"
 )
 
 type contextKey string
@@ -13,125 +17,206 @@ func (c contextKey) String() string {
 	return "context key " + string(c)
 }
 
-// RequestID is a unique identifier for each inbound request
-var (
-	requestID       = contextKey("RequestID")
-	requestHost     = contextKey("RequestHost")
-	requestPort     = contextKey("RequestPort")
-	requestPath     = contextKey("RequestPath")
-	requestRawQuery = contextKey("RequestRawQuery")
-	requestFragment = contextKey("RequestFragment")
-)
+// requestInfoKey is the context key for the RequestInfo of
+// each inbound request
+var requestInfoKey = contextKey("RequestInfo")
+
+// RequestInfo holds the details of an inbound request known to
+// httplog at the time the request is received. The middleware
+// sets RequestInfo into the request context once per request;
+// use FromContext to retrieve it.
+type RequestInfo struct {
+	// ID is the unique identifier generated for the request
+	ID string
+	// TraceID and SpanID are taken from the traceparent or
+	// X-Cloud-Trace-Context request header, if sent
+	TraceID string
+	SpanID  string
+	// ClientID is the id of the API client, as resolved by the
+	// ClientIdentifier set in Opts
+	ClientID string
+	// Method is the HTTP method (GET, POST, PUT, etc.)
+	Method string
+	// Scheme is http or https
+	Scheme string
+	// Host and Port are split from the request Host
+	Host string
+	Port string
+	// Path, RawQuery and Fragment are taken from the request URL
+	Path     string
+	RawQuery string
+	Fragment string
+	// Proto, ProtoMajor and ProtoMinor are the protocol version
+	Proto      string
+	ProtoMajor int
+	ProtoMinor int
+	// RequestURI is the unmodified request-target sent by the client
+	RequestURI string
+	// RemoteAddr is the network address that sent the request
+	RemoteAddr string
+	// ClientIP is the IP address of the client. If the request came
+	// through one of the TrustedProxies set in Opts, it is taken from
+	// the forwarding headers, otherwise it is the IP of RemoteAddr
+	ClientIP string
+	// ForwardedProto and ForwardedHost are the protocol and host
+	// the client used, as reported by a trusted proxy
+	ForwardedProto string
+	ForwardedHost  string
+	// UserAgent is the User-Agent header sent by the client
+	UserAgent string
+	// ContentLength is the length of the request body, -1 if unknown
+	ContentLength int64
+	// Received is the UTC time the request was received
+	Received time.Time
+
+	// received is the same instant as Received, but keeps its
+	// monotonic clock reading (which the UTC conversion strips), so
+	// the elapsed time measured by NewAudit is not thrown off by
+	// changes to the wall clock. It is only set by the middleware
+	received time.Time
+}
 
-func setRequest2Context(ctx context.Context, aud *tracker) context.Context {
-	ctx = setRequestHost(ctx, aud)
-	ctx = setRequestPort(ctx, aud)
-	ctx = setRequestPath(ctx, aud)
-	ctx = setRequestRawQuery(ctx, aud)
-	ctx = setRequestFragment(ctx, aud)
+// NewContext returns a copy of ctx carrying ri. The middleware calls
+// this for each request; it is exported so handlers can be tested
+// without the middleware.
+func NewContext(ctx context.Context, ri RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey, ri)
+}
 
-	return ctx
+// FromContext returns the RequestInfo set into ctx by the
+// middleware. ok is false if there is none.
+func FromContext(ctx context.Context) (ri RequestInfo, ok bool) {
+	ri, ok = ctx.Value(requestInfoKey).(RequestInfo)
+	return ri, ok
 }
 
-// SetRequestID adds a unique ID as RequestID to the context
-func setRequestID(ctx context.Context) context.Context {
-	// get byte Array representation of guid from xid package (12 bytes)
-	guid := xid.New()
+// setRequest2Context adds the RequestInfo for the request being
+// tracked to the context, along with a child of lgr carrying the
+// request id (and trace and client ids, if present)
+func setRequest2Context(ctx context.Context, lgr zerolog.Logger, aud *tracker) context.Context {
+	ri := RequestInfo{
+		ID:             aud.requestID,
+		TraceID:        aud.traceID,
+		SpanID:         aud.spanID,
+		ClientID:       aud.clientID,
+		Method:         aud.request.method,
+		Scheme:         aud.request.scheme,
+		Host:           aud.request.host,
+		Port:           aud.request.port,
+		Path:           aud.request.path,
+		RawQuery:       aud.request.rawQuery,
+		Fragment:       aud.request.fragment,
+		Proto:          aud.request.proto,
+		ProtoMajor:     aud.request.protoMajor,
+		ProtoMinor:     aud.request.protoMinor,
+		RequestURI:     aud.request.requestURI,
+		RemoteAddr:     aud.request.remoteAddr,
+		ClientIP:       aud.request.clientIP,
+		ForwardedProto: aud.request.forwardedProto,
+		ForwardedHost:  aud.request.forwardedHost,
+		UserAgent:      aud.request.userAgent,
+		ContentLength:  aud.request.contentLength,
+		Received:       aud.timeStarted,
+		received:       aud.latency.received,
+	}
 
-	// use the String method of the guid object to convert byte array to string (20 bytes)
-	rID := guid.String()
+	lc := lgr.With().Str("request_id", aud.requestID)
+	if aud.traceID != "" {
+		lc = lc.Str("trace_id", aud.traceID)
+	}
+	if aud.spanID != "" {
+		lc = lc.Str("span_id", aud.spanID)
+	}
+	if aud.clientID != "" {
+		lc = lc.Str("client_id", aud.clientID)
+	}
+	rl := lc.Logger()
+	ctx = rl.WithContext(ctx)
 
-	ctx = context.WithValue(ctx, requestID, rID)
+	ctx = context.WithValue(ctx, requestStateKey, aud.state)
+	ctx = errs.NewRequestIDContext(ctx, aud.requestID)
+
+	return NewContext(ctx, ri)
+}
+
+// Logger returns the request scoped logger set into the context
+// by the middleware. The logger is a child of the logger passed
+// to the middleware and carries the request_id field (and trace_id
+// and span_id if sent by the caller). It is the same logger returned
+// by zerolog.Ctx. If ctx has no logger, a disabled logger is returned
+// (or zerolog.DefaultContextLogger if set).
+func Logger(ctx context.Context) *zerolog.Logger {
+	return zerolog.Ctx(ctx)
+}
 
-	return ctx
+// newRequestID returns a unique ID for a request
+func newRequestID() string {
+	// get byte Array representation of guid from xid package (12 bytes)
+	guid := xid.New()
 
+	// use the String method of the guid object to convert byte array to string (20 bytes)
+	return guid.String()
 }
 
 // RequestID gets the Request ID from the context.
 func RequestID(ctx context.Context) (string, error) {
-	requestIDstr, ok := ctx.Value(requestID).(string)
+	ri, ok := FromContext(ctx)
 	if ok {
-		return requestIDstr, nil
+		return ri.ID, nil
 	}
-	return requestIDstr, errors.New("RequestID is not set properly to context")
-}
-
-// SetRequestHost adds the request host to the context
-func setRequestHost(ctx context.Context, audit *tracker) context.Context {
-	host := audit.request.host
-	ctx = context.WithValue(ctx, requestHost, host)
-	return ctx
+	return "", errors.New("RequestID is not set properly to context")
 }
 
 // RequestHost gets the request host from the context
 func RequestHost(ctx context.Context) (string, error) {
-	url, ok := ctx.Value(requestHost).(string)
+	ri, ok := FromContext(ctx)
 	if ok {
-		return url, nil
+		return ri.Host, nil
 	}
-	return url, errors.New("RequestHost is not set properly to context")
-}
-
-// SetRequestPort adds the request port to the context
-func setRequestPort(ctx context.Context, audit *tracker) context.Context {
-	port := audit.request.port
-	ctx = context.WithValue(ctx, requestPort, port)
-	return ctx
+	return "", errors.New("RequestHost is not set properly to context")
 }
 
 // RequestPort gets the request port from the context
 func RequestPort(ctx context.Context) (string, error) {
-	url, ok := ctx.Value(requestPort).(string)
+	ri, ok := FromContext(ctx)
 	if ok {
-		return url, nil
+		return ri.Port, nil
 	}
-	return url, errors.New("RequestPort is not set properly to context")
-}
-
-// SetRequestPath adds the request URL to the context
-func setRequestPath(ctx context.Context, audit *tracker) context.Context {
-	path := audit.request.path
-	ctx = context.WithValue(ctx, requestPath, path)
-	return ctx
+	return "", errors.New("RequestPort is not set properly to context")
 }
 
 // RequestPath gets the request URL from the context
 func RequestPath(ctx context.Context) (string, error) {
-	url, ok := ctx.Value(requestPath).(string)
+	ri, ok := FromContext(ctx)
 	if ok {
-		return url, nil
+		return ri.Path, nil
 	}
-	return url, errors.New("RequestPath is not set properly to context")
-}
-
-// SetRequestRawQuery adds the request Query string details to the context
-func setRequestRawQuery(ctx context.Context, audit *tracker) context.Context {
-	query := audit.request.rawQuery
-	ctx = context.WithValue(ctx, requestRawQuery, query)
-	return ctx
+	return "", errors.New("RequestPath is not set properly to context")
 }
 
 // RequestRawQuery gets the request Query string details from the context
 func RequestRawQuery(ctx context.Context) (string, error) {
-	url, ok := ctx.Value(requestRawQuery).(string)
+	ri, ok := FromContext(ctx)
 	if ok {
-		return url, nil
+		return ri.RawQuery, nil
 	}
-	return url, errors.New("RequestRawQuery is not set properly to context")
-}
-
-// SetRequestFragment adds the request Fragment details to the context
-func setRequestFragment(ctx context.Context, audit *tracker) context.Context {
-	frag := audit.request.fragment
-	ctx = context.WithValue(ctx, requestFragment, frag)
-	return ctx
+	return "", errors.New("RequestRawQuery is not set properly to context")
 }
 
 // RequestFragment gets the request Fragment details from the context
 func RequestFragment(ctx context.Context) (string, error) {
-	url, ok := ctx.Value(requestFragment).(string)
+	ri, ok := FromContext(ctx)
+	if ok {
+		return ri.Fragment, nil
+	}
+	return "", errors.New("RequestFragment is not set properly to context")
+}
+
+// RequestClientIP gets the resolved client IP address from the context
+func RequestClientIP(ctx context.Context) (string, error) {
+	ri, ok := FromContext(ctx)
 	if ok {
-		return url, nil
+		return ri.ClientIP, nil
 	}
-	return url, errors.New("RequestFragment is not set properly to context")
+	return "", errors.New("RequestClientIP is not set properly to context")
 }
@@ -0,0 +1,146 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/gilcrest/httplog/errs"
+)
+
+// newTestRequestContext returns the context and tracker the
+// middleware sets up for req, with log as the request logger. A nil
+// req is a GET of http://example.com:8080/foo
+func newTestRequestContext(t *testing.T, req *http.Request, log zerolog.Logger) (context.Context, *tracker) {
+	t.Helper()
+
+	if req == nil {
+		req = httptest.NewRequest("GET", "http://example.com:8080/foo", nil)
+	}
+	_, aud, err := newAPIAudit(req.Context(), zerolog.Nop(), req, nil, nil)
+	if err != nil {
+		t.Fatalf("newAPIAudit() error = %v", err)
+	}
+	return setRequest2Context(req.Context(), log, aud), aud
+}
+
+func TestFromContext(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com:8080/foo?bar=baz", nil)
+	req.URL.Fragment = "frag"
+	req.Header.Set("User-Agent", "test-agent/1.0")
+
+	ctx, aud := newTestRequestContext(t, req, zerolog.Nop())
+
+	ri, ok := FromContext(ctx)
+	if !ok {
+		t.Fatal("FromContext() ok = false, want true")
+	}
+
+	want := RequestInfo{
+		ID:            aud.requestID,
+		Method:        "GET",
+		Scheme:        "http",
+		Host:          "example.com",
+		Port:          "8080",
+		Path:          "/foo",
+		RawQuery:      "bar=baz",
+		Fragment:      "frag",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		RequestURI:    "http://example.com:8080/foo?bar=baz",
+		RemoteAddr:    "192.0.2.1:1234",
+		ClientIP:      "192.0.2.1",
+		UserAgent:     "test-agent/1.0",
+		ContentLength: 0,
+		Received:      aud.timeStarted,
+		received:      aud.latency.received,
+	}
+	if ri != want {
+		t.Errorf("FromContext() = %+v, want %+v", ri, want)
+	}
+
+	// the start of the request is a single instant, in UTC
+	if !ri.Received.Equal(aud.latency.received) || ri.Received.Location() != time.UTC {
+		t.Errorf("Received = %v, want %v in UTC", ri.Received, aud.latency.received)
+	}
+
+	// the request id is also set for the errs package
+	if id, ok := errs.RequestIDFromContext(ctx); !ok || id != want.ID {
+		t.Errorf("errs.RequestIDFromContext() = %s, %v, want %s", id, ok, want.ID)
+	}
+
+	// the single value helpers are built on RequestInfo
+	if id, err := RequestID(ctx); err != nil || id != want.ID {
+		t.Errorf("RequestID() = %s, %v, want %s", id, err, want.ID)
+	}
+	if host, err := RequestHost(ctx); err != nil || host != want.Host {
+		t.Errorf("RequestHost() = %s, %v, want %s", host, err, want.Host)
+	}
+	if frag, err := RequestFragment(ctx); err != nil || frag != want.Fragment {
+		t.Errorf("RequestFragment() = %s, %v, want %s", frag, err, want.Fragment)
+	}
+}
+
+func TestFromContext_NotSet(t *testing.T) {
+	ctx := context.Background()
+
+	if _, ok := FromContext(ctx); ok {
+		t.Error("FromContext() ok = true, want false")
+	}
+	if _, err := RequestID(ctx); err == nil {
+		t.Error("RequestID() error = nil, want error")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com:8080/foo", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	var b bytes.Buffer
+	ctx, aud := newTestRequestContext(t, req, zerolog.New(&b))
+
+	Logger(ctx).Info().Msg("from handler")
+
+	got := b.String()
+	for _, want := range []string{
+		`"request_id":"` + aud.requestID + `"`,
+		`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"span_id":"00f067aa0ba902b7"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Logger() output = %s, want it to contain %s", got, want)
+		}
+	}
+}
+
+func Test_traceIDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		wantTrace string
+		wantSpan  string
+	}{
+		{"traceparent", "traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"bad traceparent", "traceparent", "00-abc-def-01", "", ""},
+		{"cloud trace", "X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1", "105445aa7843bc8bf206b12000100000", "1"},
+		{"none", "X-Other", "x", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(tt.header, tt.value)
+			gotTrace, gotSpan := traceIDs(h)
+			if gotTrace != tt.wantTrace || gotSpan != tt.wantSpan {
+				t.Errorf("traceIDs() = %q, %q, want %q, %q", gotTrace, gotSpan, tt.wantTrace, tt.wantSpan)
+			}
+		})
+	}
+}
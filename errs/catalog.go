@@ -0,0 +1,183 @@
+package errs
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Catalog holds the client facing messages for error Codes, in one
+// or more languages. Messages may contain the placeholder {param},
+// which is replaced with the Param of the error. Once set with
+// SetCatalog, the message for the Code of an error (and of each of
+// its field errors) replaces the error message in the response body;
+// the original message is still logged. Errors whose Code is not in
+// the catalog are sent as before. A Catalog is safe for concurrent use.
+type Catalog struct {
+	mu          sync.RWMutex
+	defaultLang string
+	messages    map[Code]map[string]string
+}
+
+// NewCatalog returns an empty Catalog. defaultLang (e.g. "en") is the
+// language used when the request accepts none of the languages a
+// message is available in.
+func NewCatalog(defaultLang string) *Catalog {
+	return &Catalog{
+		defaultLang: strings.ToLower(defaultLang),
+		messages:    make(map[Code]map[string]string),
+	}
+}
+
+// Add adds the message for code in lang, a language tag such as
+// "en", "fr" or "pt-BR". Adding a message again replaces it.
+func (c *Catalog) Add(code Code, lang, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.messages[code]
+	if !ok {
+		m = make(map[string]string)
+		c.messages[code] = m
+	}
+	m[strings.ToLower(lang)] = message
+}
+
+// Message returns the message for code in the language best matching
+// acceptLanguage (an Accept-Language header value, which may be
+// empty), with {param} replaced by param. ok is false if code is
+// not in the catalog.
+func (c *Catalog) Message(code Code, param Parameter, acceptLanguage string) (msg string, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	m, ok := c.messages[code]
+	if !ok {
+		return "", false
+	}
+
+	msg, ok = c.pick(m, acceptLanguage)
+	if !ok {
+		return "", false
+	}
+
+	return strings.ReplaceAll(msg, "{param}", string(param)), true
+}
+
+// pick chooses the message in the most preferred available language,
+// falling back to the default language. c.mu must be held
+func (c *Catalog) pick(m map[string]string, acceptLanguage string) (string, bool) {
+	for _, lang := range parseAcceptLanguage(acceptLanguage) {
+		if lang == "*" {
+			break
+		}
+		if msg, ok := m[lang]; ok {
+			return msg, true
+		}
+		// fall back from a regional tag (fr-ca) to the language (fr)
+		if i := strings.Index(lang, "-"); i > 0 {
+			if msg, ok := m[lang[:i]]; ok {
+				return msg, true
+			}
+		}
+	}
+
+	msg, ok := m[c.defaultLang]
+	return msg, ok
+}
+
+// parseAcceptLanguage returns the lower cased language tags of an
+// Accept-Language header, most preferred first. Tags with q=0 are
+// left out
+func parseAcceptLanguage(h string) []string {
+	type tagQ struct {
+		tag string
+		q   float64
+	}
+	var tags []tagQ
+	for _, part := range strings.Split(h, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tagQ{tag, q})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	langs := make([]string, len(tags))
+	for i, t := range tags {
+		langs[i] = t.tag
+	}
+	return langs
+}
+
+// catalogJSON is the JSON form of a Catalog
+type catalogJSON struct {
+	DefaultLanguage string                     `json:"default_language"`
+	Codes           map[Code]map[string]string `json:"codes"`
+}
+
+// MarshalJSON implements json.Marshaler, so the catalog can be
+// exported, e.g. for API documentation. Codes are keyed by code and
+// then language
+func (c *Catalog) MarshalJSON() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return json.Marshal(catalogJSON{DefaultLanguage: c.defaultLang, Codes: c.messages})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading a catalog in
+// the format written by MarshalJSON
+func (c *Catalog) UnmarshalJSON(b []byte) error {
+	var cj catalogJSON
+	if err := json.Unmarshal(b, &cj); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultLang = strings.ToLower(cj.DefaultLanguage)
+	c.messages = make(map[Code]map[string]string, len(cj.Codes))
+	for code, m := range cj.Codes {
+		c.messages[code] = make(map[string]string, len(m))
+		for lang, msg := range m {
+			c.messages[code][strings.ToLower(lang)] = msg
+		}
+	}
+	return nil
+}
+
+// Export writes the catalog to w as indented JSON
+func (c *Catalog) Export(w io.Writer) error {
+	b, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// SetCatalog sets the Catalog used for the messages of error
+// responses. Pass nil (the default) to send error messages as they
+// are. It is meant to be called once at startup.
+func SetCatalog(c *Catalog) {
+	responseConfig.mu.Lock()
+	responseConfig.catalog = c
+	responseConfig.mu.Unlock()
+}
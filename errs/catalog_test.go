@@ -0,0 +1,134 @@
+package errs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func newTestCatalog() *Catalog {
+	c := NewCatalog("en")
+	c.Add("0212", "en", "{param} is not valid")
+	c.Add("0212", "fr", "{param} n'est pas valide")
+	c.Add("0212", "pt-BR", "{param} não é válido")
+	c.Add(RequiredCode, "en", "{param} is required")
+	return c
+}
+
+func TestCatalog_Message(t *testing.T) {
+	c := newTestCatalog()
+
+	tests := []struct {
+		name           string
+		code           Code
+		acceptLanguage string
+		want           string
+		wantOK         bool
+	}{
+		{"no header", "0212", "", "color is not valid", true},
+		{"exact", "0212", "fr", "color n'est pas valide", true},
+		{"region fallback", "0212", "fr-CA", "color n'est pas valide", true},
+		{"region", "0212", "pt-BR", "color não é válido", true},
+		{"q values", "0212", "de, fr;q=0.5, en;q=0.9", "color is not valid", true},
+		{"q zero", "0212", "fr;q=0", "color is not valid", true},
+		{"unavailable", "0212", "de", "color is not valid", true},
+		{"default only", RequiredCode, "fr", "color is required", true},
+		{"unknown code", "9999", "en", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := c.Message(tt.code, "color", tt.acceptLanguage)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Message() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCatalog_Export(t *testing.T) {
+	c := newTestCatalog()
+
+	var b bytes.Buffer
+	if err := c.Export(&b); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	got := NewCatalog("")
+	if err := json.Unmarshal(b.Bytes(), got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if msg, ok := got.Message("0212", "color", "pt-br"); !ok || msg != "color não é válido" {
+		t.Errorf("Message() after round trip = %q, %v", msg, ok)
+	}
+	if msg, ok := got.Message(RequiredCode, "name", ""); !ok || msg != "name is required" {
+		t.Errorf("Message() after round trip = %q, %v", msg, ok)
+	}
+}
+
+func TestHTTPErrorResponseRequest_Catalog(t *testing.T) {
+	SetCatalog(newTestCatalog())
+	defer SetCatalog(nil)
+
+	var verrs ValidationErrors
+	verrs.Add("name", RequiredCode, "name: missing")
+	verrs.Add("zip", InvalidFormatCode, "zip has an invalid format")
+
+	l := zerolog.Nop()
+	ctx := l.WithContext(context.Background())
+
+	tests := []struct {
+		name           string
+		err            error
+		acceptLanguage string
+		want           ErrResponse
+	}{
+		{
+			name:           "translated",
+			err:            E(Validation, Parameter("color"), Code("0212"), errors.New("color must be red, green or blue")),
+			acceptLanguage: "fr-CA, en;q=0.8",
+			want: ErrResponse{Error: ServiceError{
+				Kind:    "input_validation_error",
+				Code:    "0212",
+				Param:   "color",
+				Message: "color n'est pas valide",
+			}},
+		},
+		{
+			name: "field errors",
+			err:  E(verrs),
+			want: ErrResponse{Error: ServiceError{
+				Kind:    "input_validation_error",
+				Message: "name: missing; zip has an invalid format",
+				Errors: []FieldErrorResponse{
+					{Param: "name", Code: string(RequiredCode), Message: "name is required"},
+					{Param: "zip", Code: string(InvalidFormatCode), Message: "zip has an invalid format"},
+				},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+
+			w := httptest.NewRecorder()
+			HTTPErrorResponseRequest(w, req, tt.err)
+
+			var got ErrResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			gotB, _ := json.Marshal(got)
+			wantB, _ := json.Marshal(tt.want)
+			if !bytes.Equal(gotB, wantB) {
+				t.Errorf("response = %s, want %s", gotB, wantB)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package errs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// maxErrResponseBody is the most of an error response body read by
+// FromResponse
+const maxErrResponseBody = 1 << 20
+
+// statusKinds maps HTTP status codes to Kinds, for error responses
+// which do not name a registered Kind
+var statusKinds = map[int]Kind{
+	http.StatusBadRequest:            InvalidRequest,
+	http.StatusNotFound:              NotExist,
+	http.StatusConflict:              Conflict,
+	http.StatusRequestEntityTooLarge: TooLarge,
+	http.StatusTooManyRequests:       TooManyRequests,
+	StatusClientClosedRequest:        Canceled,
+	http.StatusServiceUnavailable:    Unavailable,
+	http.StatusGatewayTimeout:        Timeout,
+}
+
+var realmRe = regexp.MustCompile(`realm="([^"]*)"`)
+
+// FromResponse returns the error sent in resp by another service, the
+// reverse of HTTPErrorResponse, so KindIs and Match work across
+// service boundaries. It returns nil if the status code is below
+// 400. A 401 returns an *UnauthenticatedError with the realm of the
+// WWW-Authenticate header and a 403 an *UnauthorizedError. Other
+// statuses return an *Error built from the ErrResponse (or Problem
+// Details) body: the Kind is the registered Kind named by the body
+// (or else is mapped from the status code), Code, Param and the
+// message are kept, field errors become a ValidationErrors and the
+// Retry-After and RateLimit headers a Retry. If the body can't be
+// decoded, the message is the status text. FromResponse reads, but
+// does not close, resp.Body.
+func FromResponse(resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	msg := statusText(resp.StatusCode)
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		var realm string
+		if m := realmRe.FindStringSubmatch(resp.Header.Get("WWW-Authenticate")); m != nil {
+			realm = m[1]
+		}
+		return NewUnauthenticatedError(realm, errors.New(msg))
+	case http.StatusForbidden:
+		return NewUnauthorizedError(errors.New(msg))
+	}
+
+	se, _ := decodeServiceError(resp)
+
+	e := &Error{
+		Code:  Code(se.Code),
+		Param: Parameter(se.Param),
+		Retry: retryFromHeader(resp.Header),
+	}
+
+	if k, ok := ParseKind(se.Kind); ok {
+		e.Kind = k
+	} else if k, ok := statusKinds[resp.StatusCode]; ok {
+		e.Kind = k
+	} else if resp.StatusCode >= http.StatusInternalServerError {
+		e.Kind = Unanticipated
+	} else {
+		e.Kind = InvalidRequest
+	}
+
+	var verrs ValidationErrors
+	for _, fe := range se.Errors {
+		verrs.Add(Parameter(fe.Param), Code(fe.Code), fe.Message)
+	}
+	switch {
+	case len(verrs) > 0:
+		e.Err = verrs
+	case se.Message != "":
+		e.Err = errors.New(se.Message)
+	default:
+		e.Err = errors.New(msg)
+	}
+
+	return e
+}
+
+// decodeServiceError decodes the ErrResponse or Problem Details body
+// of resp
+func decodeServiceError(resp *http.Response) (ServiceError, error) {
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxErrResponseBody))
+	if err != nil {
+		return ServiceError{}, err
+	}
+
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == ProblemContentType {
+		var p Problem
+		if err := json.Unmarshal(b, &p); err != nil {
+			return ServiceError{}, err
+		}
+		return ServiceError{
+			Kind:      p.Kind,
+			Code:      p.Code,
+			Param:     p.Param,
+			Message:   p.Detail,
+			RequestID: p.Instance,
+			Errors:    p.Errors,
+		}, nil
+	}
+
+	var er ErrResponse
+	if err := json.Unmarshal(b, &er); err != nil {
+		return ServiceError{}, err
+	}
+	return er.Error, nil
+}
+
+// retryFromHeader returns the Retry set in the Retry-After and
+// RateLimit headers of h, or nil if there is no Retry-After header
+func retryFromHeader(h http.Header) *Retry {
+	ra := h.Get("Retry-After")
+	if ra == "" {
+		return nil
+	}
+
+	r := new(Retry)
+	if secs, err := strconv.Atoi(ra); err == nil {
+		r.After = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(ra); err == nil {
+		r.At = t
+	} else {
+		return nil
+	}
+
+	if limit, err := strconv.Atoi(h.Get("RateLimit-Limit")); err == nil {
+		r.Limit = limit
+		r.Remaining, _ = strconv.Atoi(h.Get("RateLimit-Remaining"))
+		if reset, err := strconv.Atoi(h.Get("RateLimit-Reset")); err == nil {
+			r.Reset = time.Duration(reset) * time.Second
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,128 @@
+package errs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// roundTrip sends err with HTTPErrorResponse and decodes the
+// response with FromResponse
+func roundTrip(t *testing.T, err error) error {
+	t.Helper()
+	w := httptest.NewRecorder()
+	HTTPErrorResponse(w, zerolog.Nop(), err)
+	resp := w.Result()
+	defer resp.Body.Close()
+	return FromResponse(resp)
+}
+
+func TestFromResponse(t *testing.T) {
+	var verrs ValidationErrors
+	verrs.Add("email", RequiredCode, "email is required")
+	verrs.Add("age", OutOfRangeCode, "age must be between 0 and 150")
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"typical", E(NotExist, Code("user_not_found"), Parameter("id"), errors.New("user 42 not found"))},
+		{"validation errors", E(verrs)},
+		{"conflict", E(Conflict, "version mismatch")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := roundTrip(t, tt.err)
+			if !Match(tt.err, got) {
+				t.Errorf("FromResponse() = %#v, want a match for %#v", got, tt.err)
+			}
+		})
+	}
+
+	// field error codes are kept
+	var gotVerrs ValidationErrors
+	if !errors.As(roundTrip(t, E(verrs)), &gotVerrs) || len(gotVerrs) != 2 || gotVerrs[0].Code != RequiredCode {
+		t.Errorf("FromResponse() ValidationErrors = %v", gotVerrs)
+	}
+
+	// hidden messages stay hidden
+	got := roundTrip(t, E(Database, "connection refused"))
+	if !KindIs(Internal, got) || strings.Contains(got.Error(), "connection refused") {
+		t.Errorf("FromResponse() = %v, want a generic Internal error", got)
+	}
+}
+
+func TestFromResponse_Retry(t *testing.T) {
+	got := roundTrip(t, E(TooManyRequests, Retry{After: 30 * time.Second, Limit: 100, Remaining: 0}, "rate limit exceeded"))
+	if !KindIs(TooManyRequests, got) {
+		t.Errorf("FromResponse() = %v, want TooManyRequests", got)
+	}
+	r, ok := RetryOf(got)
+	if !ok || r.After != 30*time.Second || r.Limit != 100 || r.Reset != 30*time.Second {
+		t.Errorf("RetryOf() = %+v, %v", r, ok)
+	}
+}
+
+func TestFromResponse_Problem(t *testing.T) {
+	SetResponseFormat(ProblemFormat)
+	defer SetResponseFormat(DefaultFormat)
+
+	err := E(Validation, Code("0212"), Parameter("color"), errors.New("color must be red, green or blue"))
+	if got := roundTrip(t, err); !Match(err, got) {
+		t.Errorf("FromResponse() = %#v, want a match for %#v", got, err)
+	}
+}
+
+func TestFromResponse_Status(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		header   http.Header
+		body     string
+		wantErr  error
+		wantKind Kind
+	}{
+		{"ok", http.StatusOK, nil, "", nil, Other},
+		{"unauthenticated", http.StatusUnauthorized, http.Header{"Www-Authenticate": {`Bearer realm="users"`}}, "",
+			NewUnauthenticatedError("users", errors.New("Unauthorized")), Other},
+		{"unauthorized", http.StatusForbidden, nil, "", NewUnauthorizedError(errors.New("Forbidden")), Other},
+		{"not json", http.StatusBadGateway, nil, "<html>bad gateway</html>", E(Unanticipated, "Bad Gateway"), Unanticipated},
+		{"unavailable", http.StatusServiceUnavailable, http.Header{"Retry-After": {"Thu, 21 Oct 2021 07:28:00 GMT"}}, "", E(Unavailable, "Service Unavailable"), Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			for k, v := range tt.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(tt.status)
+			w.WriteString(tt.body)
+
+			got := FromResponse(w.Result())
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if got != nil {
+					t.Errorf("FromResponse() = %v, want nil", got)
+				}
+			case *UnauthenticatedError:
+				if !MatchUnauthenticated(want, got) {
+					t.Errorf("FromResponse() = %#v, want %#v", got, want)
+				}
+			case *UnauthorizedError:
+				var ue *UnauthorizedError
+				if !errors.As(got, &ue) || ue.Error() != want.Error() {
+					t.Errorf("FromResponse() = %#v, want %#v", got, want)
+				}
+			default:
+				if !Match(want, got) || !KindIs(tt.wantKind, got) {
+					t.Errorf("FromResponse() = %#v, want %#v", got, want)
+				}
+			}
+		})
+	}
+}
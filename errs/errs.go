@@ -10,10 +10,13 @@
 package errs
 
 import (
+	"context"
 	"fmt"
 	"runtime"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
 // Error is the type that implements the error interface.
@@ -22,6 +25,10 @@ import (
 type Error struct {
 	// User is the username of the user attempting the operation.
 	User UserName
+	// Op is the operation being performed, usually the name of
+	// the method being invoked (Get, Put, etc.). It should not
+	// contain an at sign @.
+	Op Op
 	// Kind is the class of error, such as permission failure,
 	// or "Other" if its class is unknown or irrelevant.
 	Kind Kind
@@ -29,12 +36,14 @@ type Error struct {
 	Param Parameter
 	// Code is a human-readable, short representation of the error
 	Code Code
+	// Retry tells the client when it may retry, if set.
+	Retry *Retry
 	// The underlying error that triggered this one, if any.
 	Err error
 }
 
 func (e *Error) isZero() bool {
-	return e.User == "" && e.Kind == 0 && e.Param == "" && e.Code == "" && e.Err == nil
+	return e.Op == "" && e.User == "" && e.Kind == 0 && e.Param == "" && e.Code == "" && e.Retry == nil && e.Err == nil
 }
 
 // Unwrap method allows for unwrapping errors using errors.As
@@ -42,10 +51,120 @@ func (e Error) Unwrap() error {
 	return e.Err
 }
 
+// Error returns the Op trail of the error followed by the message
+// of the underlying error, e.g. "service.CreateUser: repo.Insert:
+// duplicate key". Wrapping levels with no Op (e.g. those only
+// setting a Kind) are skipped, not the levels they wrap
 func (e *Error) Error() string {
-	return e.Err.Error()
+	var trail []string
+	for err := e; err != nil; {
+		if err.Op != "" {
+			trail = append(trail, string(err.Op))
+		}
+		err, _ = err.Err.(*Error)
+	}
+	if msg := e.message(); msg != "" {
+		trail = append(trail, msg)
+	}
+	return strings.Join(trail, ": ")
+}
+
+// message returns the message of the underlying error without the
+// Op trail. It is the message sent to clients
+func (e *Error) message() string {
+	switch err := e.Err.(type) {
+	case nil:
+		return ""
+	case *Error:
+		return err.message()
+	default:
+		return err.Error()
+	}
+}
+
+// Ops returns the Op of err and of each *Error it wraps, outermost
+// first, leaving out those with no Op
+func Ops(err error) []Op {
+	var ops []Op
+	for ; err != nil; err = errors.Unwrap(err) {
+		if e, ok := err.(*Error); ok && e.Op != "" {
+			ops = append(ops, e.Op)
+		}
+	}
+	return ops
+}
+
+// opTrail returns the Ops of err joined by ": "
+func opTrail(err error) string {
+	ops := Ops(err)
+	trail := make([]string, len(ops))
+	for i, op := range ops {
+		trail[i] = string(op)
+	}
+	return strings.Join(trail, ": ")
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler, so
+// an Error can be logged as structured fields with Object, e.g.
+// log.Error().Object("error_detail", e). Empty fields are left out.
+// Stack holds the pkg/errors stack frames of the error, if any.
+func (e *Error) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("Error", e.Error())
+	if e.Kind != Other {
+		ev.Str("Kind", e.Kind.String())
+	}
+	if e.Code != "" {
+		ev.Str("Code", string(e.Code))
+	}
+	if e.Param != "" {
+		ev.Str("Parameter", string(e.Param))
+	}
+	if e.User != "" {
+		ev.Str("User", string(e.User))
+	}
+	if trail := opTrail(e); trail != "" {
+		ev.Str("Op", trail)
+	}
+	if st := stackTrace(e); len(st) > 0 {
+		arr := zerolog.Arr()
+		for _, f := range st {
+			arr.Object(stackFrame(f))
+		}
+		ev.Array("Stack", arr)
+	}
+}
+
+// stackFrame logs a pkg/errors stack frame with the same fields as
+// the zerolog pkgerrors stack marshaler
+type stackFrame errors.Frame
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler
+func (f stackFrame) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("func", fmt.Sprintf("%n", errors.Frame(f))).
+		Str("source", fmt.Sprintf("%s", errors.Frame(f))).
+		Str("line", fmt.Sprintf("%d", errors.Frame(f)))
 }
 
+// stackTrace returns the stack trace of the innermost error in the
+// chain of err which has one
+func stackTrace(err error) errors.StackTrace {
+	type stackTracer interface {
+		StackTrace() errors.StackTrace
+	}
+
+	var st errors.StackTrace
+	for ; err != nil; err = errors.Unwrap(err) {
+		if t, ok := err.(stackTracer); ok {
+			st = t.StackTrace()
+		}
+	}
+	return st
+}
+
+// Op describes an operation, usually as the package and method,
+// such as "service.CreateUser".
+type Op string
+
 // UserName is a string representing a user
 type UserName string
 
@@ -66,46 +185,29 @@ type Code string
 // any items since that will change their values.
 // New items must be added only to the end.
 const (
-	Other          Kind = iota // Unclassified error. This value is not printed in the error message.
-	Invalid                    // Invalid operation for this type of item.
-	IO                         // External I/O error such as network failure.
-	Exist                      // Item already exists.
-	NotExist                   // Item does not exist.
-	Private                    // Information withheld.
-	Internal                   // Internal error or inconsistency.
-	BrokenLink                 // Link target does not exist.
-	Database                   // Error from database.
-	Validation                 // Input validation error.
-	Unanticipated              // Unanticipated error.
-	InvalidRequest             // Invalid Request
+	Other           Kind = iota // Unclassified error. This value is not printed in the error message.
+	Invalid                     // Invalid operation for this type of item.
+	IO                          // External I/O error such as network failure.
+	Exist                       // Item already exists.
+	NotExist                    // Item does not exist.
+	Private                     // Information withheld.
+	Internal                    // Internal error or inconsistency.
+	BrokenLink                  // Link target does not exist.
+	Database                    // Error from database.
+	Validation                  // Input validation error.
+	Unanticipated               // Unanticipated error.
+	InvalidRequest              // Invalid Request
+	Conflict                    // Request conflicts with the current state of the item.
+	TooManyRequests             // Rate limit exceeded.
+	Unavailable                 // Service temporarily unavailable.
+	Timeout                     // Operation timed out (context.DeadlineExceeded).
+	Canceled                    // Operation canceled (context.Canceled).
+	TooLarge                    // Request entity too large.
 )
 
 func (k Kind) String() string {
-	switch k {
-	case Other:
-		return "other_error"
-	case Invalid:
-		return "invalid_operation"
-	case IO:
-		return "I/O_error"
-	case Exist:
-		return "item_already_exists"
-	case NotExist:
-		return "item_does_not_exist"
-	case BrokenLink:
-		return "link_target_does_not_exist"
-	case Private:
-		return "information_withheld"
-	case Internal:
-		return "internal_error"
-	case Database:
-		return "database_error"
-	case Validation:
-		return "input_validation_error"
-	case Unanticipated:
-		return "unanticipated_error"
-	case InvalidRequest:
-		return "invalid_request_error"
+	if ki, ok := lookupKind(k); ok {
+		return ki.name
 	}
 	return "unknown_error_kind"
 }
@@ -117,13 +219,22 @@ func (k Kind) String() string {
 // only the last one is recorded.
 //
 // The types are:
+//	errs.Op
+//		The operation being performed, usually the method
+//		being invoked (Get, Put, etc.).
 //	UserName
 //		The username of the user attempting the operation.
+//	context.Context
+//		The username set into the context by NewUserContext (or
+//		httplog.SetUser), if any, is used as the UserName.
 //	string
 //		Treated as an error message and assigned to the
 //		Err field after a call to errors.New.
 //	errors.Kind
 //		The class of error, such as permission failure.
+//	Retry
+//		When the client may retry the request (see RetryAfter
+//		and RetryAt).
 //	error
 //		The underlying error that triggered this one.
 //
@@ -131,7 +242,10 @@ func (k Kind) String() string {
 // set to non-zero values will appear in the result.
 //
 // If Kind is not specified or Other, we set it to the Kind of
-// the underlying error.
+// the underlying error. If the underlying error is (or wraps)
+// context.DeadlineExceeded or context.Canceled, and no *Error it
+// wraps has a Kind, the Kind is set to Timeout or Canceled. If it
+// is a ValidationErrors, the Kind is set to Validation.
 //
 func E(args ...interface{}) error {
 	type stackTracer interface {
@@ -144,8 +258,14 @@ func E(args ...interface{}) error {
 	e := &Error{}
 	for _, arg := range args {
 		switch arg := arg.(type) {
+		case Op:
+			e.Op = arg
 		case UserName:
 			e.User = arg
+		case context.Context:
+			if u, ok := UserFromContext(arg); ok {
+				e.User = u
+			}
 		case string:
 			e.Err = errors.New(arg)
 		case Kind:
@@ -166,12 +286,27 @@ func E(args ...interface{}) error {
 			e.Code = arg
 		case Parameter:
 			e.Param = arg
+		case Retry:
+			r := arg
+			e.Retry = &r
 		default:
 			_, file, line, _ := runtime.Caller(1)
 			return fmt.Errorf("errors.E: bad call from %s:%d: %v, unknown type %T, value %v in error call", file, line, args, arg, arg)
 		}
 	}
 
+	// infer the Kind from the underlying error only if no *Error
+	// it wraps has a Kind, which would otherwise be overridden
+	if e.Kind == Other && !hasKind(e.Err) {
+		if k, ok := contextErrKind(e.Err); ok {
+			e.Kind = k
+		}
+		var verrs ValidationErrors
+		if errors.As(e.Err, &verrs) {
+			e.Kind = Validation
+		}
+	}
+
 	prev, ok := e.Err.(*Error)
 	if !ok {
 		return e
@@ -200,9 +335,35 @@ func E(args ...interface{}) error {
 		prev.Param = ""
 	}
 
+	// If this error has no Retry, pull up the inner one.
+	if e.Retry == nil {
+		e.Retry = prev.Retry
+		prev.Retry = nil
+	}
+
+	if prev.User == e.User {
+		prev.User = ""
+	}
+	// If this error has User == "", pull up the inner one.
+	if e.User == "" {
+		e.User = prev.User
+		prev.User = ""
+	}
+
 	return e
 }
 
+// hasKind reports whether err is (or wraps) an *Error with a Kind
+// other than Other
+func hasKind(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if e, ok := err.(*Error); ok && e.Kind != Other {
+			return true
+		}
+	}
+	return false
+}
+
 // Match compares its two error arguments. It can be used to check
 // for expected errors in tests. Both arguments must have underlying
 // type *Error or Match will return false. Otherwise it returns true
@@ -225,6 +386,9 @@ func Match(err1, err2 error) bool {
 	if !ok {
 		return false
 	}
+	if e1.Op != "" && e2.Op != e1.Op {
+		return false
+	}
 	if e1.User != "" && e2.User != e1.User {
 		return false
 	}
@@ -4,9 +4,15 @@
 package errs
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
 func TestNoArgs(t *testing.T) {
@@ -50,3 +56,101 @@ func TestKind(t *testing.T) {
 		}
 	}
 }
+
+func TestE_UserFromContext(t *testing.T) {
+	ctx := NewUserContext(context.Background(), UserName("joe@blow.com"))
+
+	tests := []struct {
+		name string
+		err  error
+		want UserName
+	}{
+		{"context", E(ctx, Validation, "some error"), "joe@blow.com"},
+		{"no user in context", E(context.Background(), Validation, "some error"), ""},
+		{"pulled up from inner error", E(Validation, E(ctx, "some error")), "joe@blow.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := tt.err.(*Error)
+			if !ok {
+				t.Fatalf("E() returned %T, want *Error", tt.err)
+			}
+			if e.User != tt.want {
+				t.Errorf("User = %q, want %q", e.User, tt.want)
+			}
+		})
+	}
+}
+
+func TestE_Op(t *testing.T) {
+	repoErr := E(Op("repo.Insert"), Exist, Code("dup"), errors.New("duplicate key"))
+	err := E(Op("service.CreateUser"), Parameter("username"), repoErr)
+
+	if got, want := err.Error(), "service.CreateUser: repo.Insert: duplicate key"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got := Ops(err); len(got) != 2 || got[0] != "service.CreateUser" || got[1] != "repo.Insert" {
+		t.Errorf("Ops() = %v", got)
+	}
+	if !Match(E(Op("service.CreateUser"), Exist), err) {
+		t.Error("Match() = false, want true")
+	}
+	if Match(E(Op("service.DeleteUser")), err) {
+		t.Error("Match() with another Op = true, want false")
+	}
+
+	// clients get the message without the Op trail
+	w := httptest.NewRecorder()
+	HTTPErrorResponse(w, zerolog.Nop(), err)
+	want := `{"error":{"kind":"item_already_exists","code":"dup","param":"username","message":"duplicate key"}}`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("response = %s, want %s", got, want)
+	}
+}
+
+func TestE_OpThroughKindOnlyLevel(t *testing.T) {
+	err := E(Op("service.CreateUser"), E(Database, E(Op("repo.Insert"), "duplicate key")))
+
+	if got, want := err.Error(), "service.CreateUser: repo.Insert: duplicate key"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := E(Database, E(Op("repo.Insert"), "duplicate key")).Error(), "repo.Insert: duplicate key"; got != want {
+		t.Errorf("Error() of the Op-less level = %q, want %q", got, want)
+	}
+	if got, want := opTrail(err), "service.CreateUser: repo.Insert"; got != want {
+		t.Errorf("opTrail() = %q, want %q", got, want)
+	}
+}
+
+func TestError_MarshalZerologObject(t *testing.T) {
+	err := E(Op("service.CreateUser"), UserName("repoman"), Parameter("username"),
+		E(Op("repo.Insert"), Exist, Code("dup"), errors.New("duplicate key")))
+
+	var b bytes.Buffer
+	l := zerolog.New(&b)
+	l.Error().Object("error_detail", err.(*Error)).Msg("")
+
+	var got struct {
+		Detail struct {
+			Error     string
+			Kind      string
+			Code      string
+			Parameter string
+			User      string
+			Op        string
+			Stack     []map[string]string
+		} `json:"error_detail"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	d := got.Detail
+	if d.Error != "service.CreateUser: repo.Insert: duplicate key" || d.Kind != "item_already_exists" ||
+		d.Code != "dup" || d.Parameter != "username" || d.User != "repoman" ||
+		d.Op != "service.CreateUser: repo.Insert" {
+		t.Errorf("logged = %+v", d)
+	}
+	if len(d.Stack) == 0 || !strings.HasSuffix(d.Stack[0]["func"], "TestError_MarshalZerologObject") {
+		t.Errorf("logged Stack = %v", d.Stack)
+	}
+}
@@ -0,0 +1,125 @@
+package errs
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrorGroup is a set of reported errors with the same fingerprint
+type ErrorGroup struct {
+	// Fingerprint identifies the group. It is a hash of the Kind,
+	// Code and top stack frame function of the errors
+	Fingerprint string `json:"fingerprint"`
+	Kind        string `json:"kind"`
+	Code        string `json:"code,omitempty"`
+	// Frame is the top stack frame of the latest error, as
+	// function (file:line)
+	Frame string `json:"frame,omitempty"`
+	// Message, Status and RequestID are those of the latest error
+	Message   string `json:"message"`
+	Status    int    `json:"status"`
+	RequestID string `json:"request_id,omitempty"`
+	// Panic is true if any error in the group was a panic
+	Panic     bool      `json:"panic,omitempty"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// GroupReporter is a Reporter which keeps reported errors in memory,
+// grouped by fingerprint, so repeated errors are counted rather than
+// stored again. It is also an http.Handler listing the groups as
+// JSON, most recently seen first, for an internal admin endpoint.
+// A GroupReporter is safe for concurrent use.
+type GroupReporter struct {
+	mu     sync.Mutex
+	groups map[string]*ErrorGroup
+}
+
+// NewGroupReporter returns an empty GroupReporter
+func NewGroupReporter() *GroupReporter {
+	return &GroupReporter{groups: make(map[string]*ErrorGroup)}
+}
+
+// Report implements Reporter
+func (g *GroupReporter) Report(r Report) {
+	fn, file, line, ok := r.TopFrame()
+	var frame string
+	if ok {
+		frame = fmt.Sprintf("%s (%s:%d)", fn, file, line)
+	}
+	fp := fingerprint(r.Kind, r.Code, fn)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	eg, ok := g.groups[fp]
+	if !ok {
+		eg = &ErrorGroup{
+			Fingerprint: fp,
+			Kind:        r.Kind.String(),
+			Code:        string(r.Code),
+			FirstSeen:   r.Time,
+		}
+		g.groups[fp] = eg
+	}
+	eg.Frame = frame
+	eg.Message = r.Err.Error()
+	eg.Status = r.Status
+	eg.RequestID = r.RequestID
+	eg.Panic = eg.Panic || r.Panic
+	eg.Count++
+	eg.LastSeen = r.Time
+}
+
+// fingerprint returns the hex FNV-1a hash of kind, code and the top
+// frame function. Line numbers are left out so groups survive
+// unrelated edits to the file
+func fingerprint(kind Kind, code Code, function string) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%s\x00%s", kind, code, function)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Groups returns a copy of the error groups, most recently seen first
+func (g *GroupReporter) Groups() []ErrorGroup {
+	g.mu.Lock()
+	groups := make([]ErrorGroup, 0, len(g.groups))
+	for _, eg := range g.groups {
+		groups = append(groups, *eg)
+	}
+	g.mu.Unlock()
+
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].LastSeen.Equal(groups[j].LastSeen) {
+			return groups[i].LastSeen.After(groups[j].LastSeen)
+		}
+		return groups[i].Fingerprint < groups[j].Fingerprint
+	})
+	return groups
+}
+
+// Reset removes all error groups
+func (g *GroupReporter) Reset() {
+	g.mu.Lock()
+	g.groups = make(map[string]*ErrorGroup)
+	g.mu.Unlock()
+}
+
+// ServeHTTP writes the error groups as a JSON array, most recently
+// seen first
+func (g *GroupReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b, err := json.Marshal(g.Groups())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,257 @@
+// Package grpcerrs converts errs errors to and from gRPC statuses, the
+// gRPC counterpart of errs.HTTPErrorResponse and errs.FromResponse. It
+// is kept apart from package errs so that only services importing it
+// depend on the grpc and protobuf modules.
+package grpcerrs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/gilcrest/httplog/errs"
+)
+
+// kindCodes maps the built-in Kinds to gRPC status codes. Kinds
+// which are not listed, including application Kinds, map to
+// codes.Unknown
+var kindCodes = map[errs.Kind]codes.Code{
+	errs.Other:           codes.Unknown,
+	errs.Invalid:         codes.FailedPrecondition,
+	errs.IO:              codes.Internal,
+	errs.Exist:           codes.AlreadyExists,
+	errs.NotExist:        codes.NotFound,
+	errs.Private:         codes.InvalidArgument,
+	errs.Internal:        codes.Internal,
+	errs.BrokenLink:      codes.InvalidArgument,
+	errs.Database:        codes.Internal,
+	errs.Validation:      codes.InvalidArgument,
+	errs.Unanticipated:   codes.Unknown,
+	errs.InvalidRequest:  codes.InvalidArgument,
+	errs.Conflict:        codes.Aborted,
+	errs.TooManyRequests: codes.ResourceExhausted,
+	errs.Unavailable:     codes.Unavailable,
+	errs.Timeout:         codes.DeadlineExceeded,
+	errs.Canceled:        codes.Canceled,
+	errs.TooLarge:        codes.ResourceExhausted,
+}
+
+// codeKinds maps gRPC status codes to Kinds, for statuses which have
+// no ErrorInfo detail naming the Kind
+var codeKinds = map[codes.Code]errs.Kind{
+	codes.Canceled:           errs.Canceled,
+	codes.Unknown:            errs.Unanticipated,
+	codes.InvalidArgument:    errs.Validation,
+	codes.DeadlineExceeded:   errs.Timeout,
+	codes.NotFound:           errs.NotExist,
+	codes.AlreadyExists:      errs.Exist,
+	codes.ResourceExhausted:  errs.TooManyRequests,
+	codes.FailedPrecondition: errs.Invalid,
+	codes.Aborted:            errs.Conflict,
+	codes.OutOfRange:         errs.Validation,
+	codes.Unimplemented:      errs.InvalidRequest,
+	codes.Internal:           errs.Internal,
+	codes.Unavailable:        errs.Unavailable,
+	codes.DataLoss:           errs.Internal,
+}
+
+// ErrorInfo metadata keys for the Code and Param of an Error
+const (
+	codeKey  = "code"
+	paramKey = "param"
+)
+
+// domain is the domain of the ErrorInfo detail of statuses
+var domain struct {
+	mu   sync.RWMutex
+	name string
+}
+
+// SetDomain sets the domain of the ErrorInfo detail of gRPC statuses
+// built by Status, e.g. "user.example.com". It is meant to be called
+// once at startup; the default is empty.
+func SetDomain(name string) {
+	domain.mu.Lock()
+	domain.name = name
+	domain.mu.Unlock()
+}
+
+// Status returns the gRPC status for err. The status code comes from
+// the Kind of an *errs.Error and the message is the one sent in HTTP
+// error responses (a generic message for Kinds which do not expose
+// theirs). The status has an ErrorInfo detail with the Kind as the
+// reason and the Code and Param as metadata, a BadRequest detail with
+// a field violation for each FieldError of a ValidationErrors (or for
+// the Param of a Validation error) and a RetryInfo detail if a Retry
+// is set. UnauthenticatedError and UnauthorizedError give
+// codes.Unauthenticated and codes.PermissionDenied with no details,
+// and errors from the context package give codes.DeadlineExceeded
+// and codes.Canceled. Other errors give codes.Unknown with a generic
+// message. Status returns nil for a nil error.
+func Status(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+
+	var unauthenticatedErr *errs.UnauthenticatedError
+	if errors.As(err, &unauthenticatedErr) {
+		return status.New(codes.Unauthenticated, "Unauthenticated")
+	}
+	var unauthorizedErr *errs.UnauthorizedError
+	if errors.As(err, &unauthorizedErr) {
+		return status.New(codes.PermissionDenied, "Unauthorized")
+	}
+
+	kind, se, ok := errs.NewServiceError(err)
+	if !ok {
+		return status.New(codes.Unknown, "Unexpected error - contact support")
+	}
+
+	code, ok := kindCodes[kind]
+	if !ok {
+		code = codes.Unknown
+	}
+	s := status.New(code, se.Message)
+
+	domain.mu.RLock()
+	info := &errdetails.ErrorInfo{Reason: se.Kind, Domain: domain.name}
+	domain.mu.RUnlock()
+	if se.Code != "" || se.Param != "" {
+		info.Metadata = make(map[string]string)
+		if se.Code != "" {
+			info.Metadata[codeKey] = se.Code
+		}
+		if se.Param != "" {
+			info.Metadata[paramKey] = se.Param
+		}
+	}
+	details := []proto.Message{info}
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, fe := range se.Errors {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: fe.Param, Description: fe.Message})
+	}
+	if len(violations) == 0 && kind == errs.Validation && se.Param != "" {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: se.Param, Description: se.Message})
+	}
+	if len(violations) > 0 {
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+
+	if r, ok := errs.RetryOf(err); ok {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay(r, time.Now()))})
+	}
+
+	// WithDetails only fails for an OK status, which is never
+	// built here
+	if ds, err := s.WithDetails(details...); err == nil {
+		s = ds
+	}
+
+	return s
+}
+
+// retryDelay returns how long after now the client should wait
+// before retrying
+func retryDelay(r errs.Retry, now time.Time) time.Duration {
+	d := r.After
+	if !r.At.IsZero() {
+		d = r.At.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// FromStatus returns the error for a gRPC status, e.g. one received
+// from another service, the reverse of Status. An OK (or nil) status
+// returns nil. codes.Unauthenticated and codes.PermissionDenied
+// return an *errs.UnauthenticatedError and an *errs.UnauthorizedError.
+// Other statuses return an *errs.Error with the Kind named by the
+// ErrorInfo detail reason (or else mapped from the status code), the
+// Code and Param from its metadata, a ValidationErrors holding the
+// BadRequest field violations, if any, and a Retry from the RetryInfo
+// detail, if any.
+func FromStatus(s *status.Status) error {
+	switch s.Code() {
+	case codes.OK:
+		return nil
+	case codes.Unauthenticated:
+		return errs.NewUnauthenticatedError("", errors.New(s.Message()))
+	case codes.PermissionDenied:
+		return errs.NewUnauthorizedError(errors.New(s.Message()))
+	}
+
+	e := &errs.Error{Kind: codeKinds[s.Code()]}
+	var verrs errs.ValidationErrors
+
+	for _, d := range s.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			if k, ok := errs.ParseKind(d.Reason); ok {
+				e.Kind = k
+			}
+			e.Code = errs.Code(d.Metadata[codeKey])
+			e.Param = errs.Parameter(d.Metadata[paramKey])
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				verrs.Add(errs.Parameter(v.Field), "", v.Description)
+			}
+		case *errdetails.RetryInfo:
+			e.Retry = &errs.Retry{After: d.RetryDelay.AsDuration()}
+		}
+	}
+
+	// a single violation for the Param is the error itself
+	if len(verrs) == 1 && verrs[0].Param == e.Param {
+		verrs = nil
+	}
+	if len(verrs) > 0 {
+		e.Err = verrs
+	} else {
+		e.Err = errors.New(s.Message())
+	}
+
+	return e
+}
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor which
+// converts the errors returned by unary methods with Status, so
+// methods can return errs errors as is. Errors which already carry a
+// gRPC status are returned unchanged.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, statusErr(err)
+	}
+}
+
+// StreamServerInterceptor returns a grpc.StreamServerInterceptor
+// which converts the errors returned by streaming methods with
+// Status, like UnaryServerInterceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return statusErr(handler(srv, ss))
+	}
+}
+
+// statusErr returns err as a gRPC status error, unless it is nil or
+// already has a status
+func statusErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return Status(err).Err()
+}
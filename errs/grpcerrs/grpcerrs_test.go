@@ -0,0 +1,245 @@
+package grpcerrs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/gilcrest/httplog/errs"
+)
+
+func TestStatus(t *testing.T) {
+	var verrs errs.ValidationErrors
+	verrs.Add("email", errs.RequiredCode, "email is required")
+	verrs.Add("age", errs.OutOfRangeCode, "age must be between 0 and 150")
+
+	tests := []struct {
+		name           string
+		err            error
+		wantCode       codes.Code
+		wantMsg        string
+		wantReason     string
+		wantMetadata   map[string]string
+		wantViolations []string
+		wantRetry      time.Duration
+	}{
+		{
+			name:         "not found",
+			err:          errs.E(errs.Op("repo.FindUser"), errs.NotExist, errs.Code("user_not_found"), errs.Parameter("id"), "user 42 not found"),
+			wantCode:     codes.NotFound,
+			wantMsg:      "user 42 not found",
+			wantReason:   "item_does_not_exist",
+			wantMetadata: map[string]string{"code": "user_not_found", "param": "id"},
+		},
+		{
+			name:           "validation param",
+			err:            errs.E(errs.Validation, errs.Parameter("color"), "color must be red, green or blue"),
+			wantCode:       codes.InvalidArgument,
+			wantMsg:        "color must be red, green or blue",
+			wantReason:     "input_validation_error",
+			wantMetadata:   map[string]string{"param": "color"},
+			wantViolations: []string{"color"},
+		},
+		{
+			name:           "validation errors",
+			err:            errs.E(verrs),
+			wantCode:       codes.InvalidArgument,
+			wantMsg:        "email is required; age must be between 0 and 150",
+			wantReason:     "input_validation_error",
+			wantViolations: []string{"email", "age"},
+		},
+		{
+			name:       "retry",
+			err:        errs.E(errs.TooManyRequests, errs.RetryAfter(30*time.Second), "slow down"),
+			wantCode:   codes.ResourceExhausted,
+			wantMsg:    "slow down",
+			wantReason: "too_many_requests",
+			wantRetry:  30 * time.Second,
+		},
+		{
+			name:       "internal hides message",
+			err:        errs.E(errs.Database, "connection refused"),
+			wantCode:   codes.Internal,
+			wantMsg:    "internal server error - please contact support",
+			wantReason: "internal_error",
+		},
+		{
+			name:       "context",
+			err:        context.DeadlineExceeded,
+			wantCode:   codes.DeadlineExceeded,
+			wantMsg:    "Gateway Timeout",
+			wantReason: "timeout_error",
+		},
+		{
+			name:     "unauthenticated",
+			err:      errs.NewUnauthenticatedError("", errors.New("bad token")),
+			wantCode: codes.Unauthenticated,
+			wantMsg:  "Unauthenticated",
+		},
+		{
+			name:     "unauthorized",
+			err:      errs.NewUnauthorizedError(errors.New("not an admin")),
+			wantCode: codes.PermissionDenied,
+			wantMsg:  "Unauthorized",
+		},
+		{
+			name:     "other",
+			err:      errors.New("some error"),
+			wantCode: codes.Unknown,
+			wantMsg:  "Unexpected error - contact support",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Status(tt.err)
+
+			if s.Code() != tt.wantCode || s.Message() != tt.wantMsg {
+				t.Errorf("status = %v %q, want %v %q", s.Code(), s.Message(), tt.wantCode, tt.wantMsg)
+			}
+
+			var (
+				reason     string
+				metadata   map[string]string
+				violations []string
+				retry      time.Duration
+			)
+			for _, d := range s.Details() {
+				switch d := d.(type) {
+				case *errdetails.ErrorInfo:
+					reason, metadata = d.Reason, d.Metadata
+				case *errdetails.BadRequest:
+					for _, v := range d.FieldViolations {
+						violations = append(violations, v.Field)
+					}
+				case *errdetails.RetryInfo:
+					retry = d.RetryDelay.AsDuration()
+				}
+			}
+			if reason != tt.wantReason || !reflect.DeepEqual(metadata, tt.wantMetadata) {
+				t.Errorf("ErrorInfo = %q %v, want %q %v", reason, metadata, tt.wantReason, tt.wantMetadata)
+			}
+			if !reflect.DeepEqual(violations, tt.wantViolations) {
+				t.Errorf("FieldViolations = %v, want %v", violations, tt.wantViolations)
+			}
+			if retry != tt.wantRetry {
+				t.Errorf("RetryInfo = %v, want %v", retry, tt.wantRetry)
+			}
+		})
+	}
+
+	if s := Status(nil); s != nil {
+		t.Errorf("Status(nil) = %v, want nil", s)
+	}
+}
+
+// a context error wrapped in an *Error with a hidden Kind must not
+// have its message (e.g. a query) sent to the client
+func TestStatus_WrappedDatabase(t *testing.T) {
+	const secret = "select * from secret_table where ssn=123"
+	err := errs.E(errs.Op("svc.Get"), errs.E(errs.Database, errors.Wrap(context.DeadlineExceeded, secret)))
+
+	if s := Status(err); s.Code() != codes.Internal || strings.Contains(s.Message(), "secret_table") {
+		t.Errorf("Status() = %v %q, want %v with the message hidden", s.Code(), s.Message(), codes.Internal)
+	}
+}
+
+func TestFromStatus(t *testing.T) {
+	var verrs errs.ValidationErrors
+	verrs.Add("email", errs.RequiredCode, "email is required")
+	verrs.Add("age", errs.OutOfRangeCode, "age must be between 0 and 150")
+
+	t.Run("round trip", func(t *testing.T) {
+		in := errs.E(errs.NotExist, errs.Code("user_not_found"), errs.Parameter("id"), errs.RetryAfter(time.Second), "user 42 not found")
+
+		got := FromStatus(Status(in))
+		e, ok := got.(*errs.Error)
+		if !ok {
+			t.Fatalf("FromStatus() = %T, want *errs.Error", got)
+		}
+		if e.Kind != errs.NotExist || e.Code != "user_not_found" || e.Param != "id" || e.Error() != "user 42 not found" {
+			t.Errorf("FromStatus() = %+v", e)
+		}
+		if e.Retry == nil || e.Retry.After != time.Second {
+			t.Errorf("FromStatus() Retry = %+v, want 1s", e.Retry)
+		}
+	})
+
+	t.Run("field violations", func(t *testing.T) {
+		got := FromStatus(Status(errs.E(verrs)))
+		if !errs.KindIs(errs.Validation, got) {
+			t.Errorf("FromStatus() Kind = %v, want Validation", got.(*errs.Error).Kind)
+		}
+		var gotVerrs errs.ValidationErrors
+		if !errors.As(got, &gotVerrs) || len(gotVerrs) != 2 || gotVerrs[1].Param != "age" {
+			t.Errorf("FromStatus() ValidationErrors = %v", gotVerrs)
+		}
+	})
+
+	t.Run("no details", func(t *testing.T) {
+		got := FromStatus(status.New(codes.Unavailable, "try later"))
+		if !errs.KindIs(errs.Unavailable, got) || got.Error() != "try later" {
+			t.Errorf("FromStatus() = %v", got)
+		}
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		var unauthenticatedErr *errs.UnauthenticatedError
+		if !errors.As(FromStatus(status.New(codes.Unauthenticated, "x")), &unauthenticatedErr) {
+			t.Error("FromStatus(Unauthenticated) is not an UnauthenticatedError")
+		}
+		var unauthorizedErr *errs.UnauthorizedError
+		if !errors.As(FromStatus(status.New(codes.PermissionDenied, "x")), &unauthorizedErr) {
+			t.Error("FromStatus(PermissionDenied) is not an UnauthorizedError")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		if err := FromStatus(status.New(codes.OK, "")); err != nil {
+			t.Errorf("FromStatus(OK) = %v, want nil", err)
+		}
+	})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	preset := status.Error(codes.Aborted, "preset")
+
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{nil, codes.OK},
+		{errs.E(errs.Exist, "user exists"), codes.AlreadyExists},
+		{errs.NewUnauthenticatedError("", errors.New("bad token")), codes.Unauthenticated},
+		{preset, codes.Aborted},
+	}
+	for _, tt := range tests {
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "resp", tt.err
+		}
+		resp, err := UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+		if resp != "resp" {
+			t.Errorf("resp = %v, want the handler's", resp)
+		}
+		if s, ok := status.FromError(err); !ok || s.Code() != tt.want {
+			t.Errorf("status.FromError(%v) = %v, %v, want %v", tt.err, s.Code(), ok, tt.want)
+		}
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		return errs.E(errs.NotExist, "no such user")
+	}
+	err := StreamServerInterceptor()(nil, nil, &grpc.StreamServerInfo{}, handler)
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.NotFound {
+		t.Errorf("status.FromError() = %v, %v, want %v", s.Code(), ok, codes.NotFound)
+	}
+}
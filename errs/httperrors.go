@@ -1,10 +1,11 @@
 package errs
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -21,6 +22,17 @@ type ServiceError struct {
 	Code    string `json:"code,omitempty"`
 	Param   string `json:"param,omitempty"`
 	Message string `json:"message,omitempty"`
+	// RequestID is the unique id of the request, if known
+	RequestID string `json:"request_id,omitempty"`
+	// Errors holds each field error of a ValidationErrors
+	Errors []FieldErrorResponse `json:"errors,omitempty"`
+}
+
+// FieldErrorResponse is the response body form of a FieldError
+type FieldErrorResponse struct {
+	Param   string `json:"param,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
 }
 
 // HTTPErrorResponse takes a writer, error and a logger, performs a
@@ -30,8 +42,54 @@ type ServiceError struct {
 // Error interface as defined in this package, then a proper error
 // is still formed and sent to the client, however, the Kind and
 // Code will be Unanticipated. Logging of error is also done using
-// https://github.com/rs/zerolog
+// https://github.com/rs/zerolog. The response body is written in the
+// format set with SetResponseFormat.
 func HTTPErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, err error) {
+	httpErrorResponse(w, lgr, err, newResponseOpts("", ""))
+}
+
+// HTTPErrorResponseContext is the same as HTTPErrorResponse, except
+// the error is logged with the logger associated with ctx (see
+// zerolog.Ctx). The httplog middleware sets a request scoped logger
+// carrying the request_id into the request context, so errors logged
+// this way can be tied to the request and response logs. The request
+// id, if set into ctx, is also sent in the RequestIDHeader response
+// header and as the request_id of the response body (the instance
+// of Problem Details responses).
+func HTTPErrorResponseContext(ctx context.Context, w http.ResponseWriter, err error) {
+	ro := newResponseOpts("", "")
+	ro.requestID, _ = RequestIDFromContext(ctx)
+	httpErrorResponse(w, *zerolog.Ctx(ctx), err, ro)
+}
+
+// HTTPErrorResponseRequest is the same as HTTPErrorResponseContext,
+// using the context of req, and also logs the req method and path
+// with the error. If the response format is NegotiateFormat, the
+// format is chosen using the req Accept header. If a Catalog is set,
+// messages are sent in the language chosen using the req
+// Accept-Language header.
+func HTTPErrorResponseRequest(w http.ResponseWriter, req *http.Request, err error) {
+	httpErrorResponse(w, *zerolog.Ctx(req.Context()), err, newRequestResponseOpts(req))
+}
+
+// newRequestResponseOpts returns the responseOpts for req
+func newRequestResponseOpts(req *http.Request) responseOpts {
+	ro := newResponseOpts(req.Header.Get("Accept"), req.Header.Get("Accept-Language"))
+	ro.requestID, _ = RequestIDFromContext(req.Context())
+	ro.method = req.Method
+	ro.path = req.URL.Path
+	return ro
+}
+
+// httpErrorResponse sends the response for err in the format set in ro
+func httpErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, err error, ro responseOpts) {
+	if ro.requestID != "" {
+		w.Header().Set(RequestIDHeader, ro.requestID)
+	}
+	if ro.method != "" {
+		lgr = lgr.With().Str("method", ro.method).Str("path", ro.path).Logger()
+	}
+
 	if err == nil {
 		nilErrorResponse(w, lgr)
 		return
@@ -51,11 +109,18 @@ func HTTPErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, err error) {
 
 	var typicalErr *Error
 	if errors.As(err, &typicalErr) {
-		typicalErrorResponse(w, lgr, typicalErr)
+		typicalErrorResponse(w, lgr, typicalErr, ro)
+		return
+	}
+
+	// errors from the context package, e.g. a database call
+	// which timed out, are sent with the matching Kind
+	if k, ok := contextErrKind(err); ok {
+		typicalErrorResponse(w, lgr, &Error{Kind: k, Err: err}, ro)
 		return
 	}
 
-	otherErrorResponse(w, lgr, err)
+	otherErrorResponse(w, lgr, err, ro)
 }
 
 // typicalErrorResponse replies to the request with the specified error
@@ -64,7 +129,7 @@ func HTTPErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, err error) {
 //
 // Taken from standard library and modified.
 // https://golang.org/pkg/net/http/#Error
-func typicalErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, e *Error) {
+func typicalErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, e *Error, ro responseOpts) {
 
 	httpStatusCode := httpErrorStatusCode(e.Kind)
 
@@ -80,6 +145,31 @@ func typicalErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, e *Error) {
 
 	// typical errors
 
+	// add the user to the log, if known
+	if e.User != "" {
+		lgr = lgr.With().Str("User", string(e.User)).Logger()
+	}
+
+	// add each field error to the log, if any
+	var verrs ValidationErrors
+	if errors.As(e, &verrs) {
+		arr := zerolog.Arr()
+		for _, fe := range verrs {
+			arr.Object(fe)
+		}
+		lgr = lgr.With().Array("Errors", arr).Logger()
+	}
+
+	// add the Op trail to the log, if any
+	if trail := opTrail(e); trail != "" {
+		lgr = lgr.With().Str("Op", trail).Logger()
+	}
+
+	// add the retry hint to the log, if any
+	if e.Retry != nil {
+		lgr = lgr.With().Object("Retry", *e.Retry).Logger()
+	}
+
 	// log the error with stacktrace
 	lgr.Error().Stack().Err(e.Err).
 		Int("http_statuscode", httpStatusCode).
@@ -88,44 +178,85 @@ func typicalErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, e *Error) {
 		Str("Code", string(e.Code)).
 		Msg("Error Response Sent")
 
-	// get ErrResponse
-	er := newErrResponse(e)
+	ro.report(e, httpStatusCode)
 
-	// Marshal errResponse struct to JSON for the response body
-	errJSON, _ := json.Marshal(er)
-	ejson := string(errJSON)
+	// throttled and unavailable responses tell the client when
+	// to retry
+	if e.Retry != nil && (httpStatusCode == http.StatusTooManyRequests || httpStatusCode == http.StatusServiceUnavailable) {
+		e.Retry.setHeaders(w.Header(), time.Now())
+	}
 
-	// Write Content-Type headers
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-	// Write HTTP Statuscode
-	w.WriteHeader(httpStatusCode)
+	// get ErrResponse and write it in the requested format
+	writeErrResponse(w, httpStatusCode, newErrResponse(e, ro), ro)
+}
 
-	// Write response body (json)
-	fmt.Fprintln(w, ejson)
+// NewServiceError returns the Kind of err and the ServiceError that
+// HTTPErrorResponse sends to clients for it: the message is hidden
+// for Kinds which do not expose theirs and taken from the Catalog, in
+// its default language, if one is set. It is meant for packages that
+// send errors over other transports, such as errs/grpcerrs. ok is
+// false if err is not (and does not wrap) an *Error or an error from
+// the context package; such errors are sent with a generic message.
+func NewServiceError(err error) (k Kind, se ServiceError, ok bool) {
+	var e *Error
+	if !errors.As(err, &e) {
+		k, ok := contextErrKind(err)
+		if !ok {
+			return Other, ServiceError{}, false
+		}
+		e = &Error{Kind: k, Err: err}
+	}
+	return e.Kind, newErrResponse(e, newResponseOpts("", "")).Error, true
 }
 
-func newErrResponse(err *Error) ErrResponse {
+// newErrResponse returns the response body for err. Messages are
+// taken from the Catalog in ro, if any
+func newErrResponse(err *Error, ro responseOpts) ErrResponse {
 	const msg string = "internal server error - please contact support"
 
-	switch err.Kind {
-	case Internal, Database:
-		return ErrResponse{
-			Error: ServiceError{
-				Kind:    Internal.String(),
-				Message: msg,
-			},
+	// Kinds registered as not exposing their message only send a
+	// generic message. Internal and Database errors are sent as
+	// internal_error, as they always have been, other hidden Kinds
+	// (e.g. Timeout) keep their Kind and send the status text.
+	// Unregistered Kinds send their message, as they always have
+	if ki, ok := lookupKind(err.Kind); ok && !ki.expose {
+		if err.Kind == Internal || err.Kind == Database {
+			return ErrResponse{
+				Error: ServiceError{
+					Kind:    Internal.String(),
+					Message: msg,
+				},
+			}
 		}
-	default:
 		return ErrResponse{
 			Error: ServiceError{
 				Kind:    err.Kind.String(),
-				Code:    string(err.Code),
-				Param:   string(err.Param),
-				Message: err.Error(),
+				Message: statusText(ki.status),
 			},
 		}
 	}
+
+	er := ErrResponse{
+		Error: ServiceError{
+			Kind:    err.Kind.String(),
+			Code:    string(err.Code),
+			Param:   string(err.Param),
+			Message: ro.message(err.Code, err.Param, err.message()),
+		},
+	}
+
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		for _, fe := range verrs {
+			er.Error.Errors = append(er.Error.Errors, FieldErrorResponse{
+				Param:   string(fe.Param),
+				Code:    string(fe.Code),
+				Message: ro.message(fe.Code, fe.Param, fe.Message),
+			})
+		}
+	}
+
+	return er
 }
 
 // unauthenticatedErrorResponse responds with an http status code set
@@ -163,7 +294,7 @@ func nilErrorResponse(w http.ResponseWriter, lgr zerolog.Logger) {
 
 // otherErrorResponse responds with an http status code set to 500 (Internal Server Error)
 // and a json response body with unanticipated_error kind
-func otherErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, err error) {
+func otherErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, err error, ro responseOpts) {
 	er := ErrResponse{
 		Error: ServiceError{
 			Kind:    Unanticipated.String(),
@@ -174,34 +305,22 @@ func otherErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, err error) {
 
 	lgr.Error().Err(err).Msg("Unknown Error")
 
-	// Marshal errResponse struct to JSON for the response body
-	errJSON, _ := json.Marshal(er)
-	ejson := string(errJSON)
-
-	// Write Content-Type headers
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-	// Write HTTP Statuscode
-	w.WriteHeader(http.StatusInternalServerError)
+	ro.report(err, http.StatusInternalServerError)
 
-	// Write response body (json)
-	fmt.Fprintln(w, ejson)
+	writeErrResponse(w, http.StatusInternalServerError, er, ro)
 }
 
 // httpErrorStatusCode maps an error Kind to an HTTP Status Code
+// using the Kinds registered with RegisterKind
 func httpErrorStatusCode(k Kind) int {
-	switch k {
-	case Invalid, Exist, NotExist, Private, BrokenLink, Validation, InvalidRequest:
-		return http.StatusBadRequest
 	// the zero value of Kind is Other, so if no Kind is present
 	// in the error, Other is used. Errors should always have a
-	// Kind set, otherwise, a 500 will be returned and no
-	// error message will be sent to the caller
-	case Other, IO, Internal, Database, Unanticipated:
-		return http.StatusInternalServerError
-	default:
-		return http.StatusInternalServerError
+	// Kind set, otherwise, a 500 will be returned. Kinds which
+	// are not registered also return a 500
+	if ki, ok := lookupKind(k); ok {
+		return ki.status
 	}
+	return http.StatusInternalServerError
 }
 
 // NewUnauthenticatedError is an initializer for UnauthenticatedError
@@ -2,6 +2,8 @@ package errs
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -23,8 +25,8 @@ func Test_httpErrorStatusCode(t *testing.T) {
 		args args
 		want int
 	}{
-		{"Exist", args{k: Exist}, http.StatusBadRequest},
-		{"NotExist", args{k: NotExist}, http.StatusBadRequest},
+		{"Exist", args{k: Exist}, http.StatusConflict},
+		{"NotExist", args{k: NotExist}, http.StatusNotFound},
 		{"Invalid", args{k: Invalid}, http.StatusBadRequest},
 		{"Private", args{k: Private}, http.StatusBadRequest},
 		{"BrokenLink", args{k: BrokenLink}, http.StatusBadRequest},
@@ -35,6 +37,12 @@ func Test_httpErrorStatusCode(t *testing.T) {
 		{"Internal", args{k: Internal}, http.StatusInternalServerError},
 		{"Database", args{k: Database}, http.StatusInternalServerError},
 		{"Unanticipated", args{k: Unanticipated}, http.StatusInternalServerError},
+		{"Conflict", args{k: Conflict}, http.StatusConflict},
+		{"TooManyRequests", args{k: TooManyRequests}, http.StatusTooManyRequests},
+		{"Unavailable", args{k: Unavailable}, http.StatusServiceUnavailable},
+		{"Timeout", args{k: Timeout}, http.StatusGatewayTimeout},
+		{"Canceled", args{k: Canceled}, StatusClientClosedRequest},
+		{"TooLarge", args{k: TooLarge}, http.StatusRequestEntityTooLarge},
 		{"Default", args{k: 99}, http.StatusInternalServerError},
 	}
 	for _, tt := range tests {
@@ -120,3 +128,58 @@ func TestHTTPErrorResponse_Body(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPErrorResponseContext(t *testing.T) {
+	var b bytes.Buffer
+	l := logger.NewLogger(&b, zerolog.DebugLevel, false).With().Str("request_id", "c0ffee").Logger()
+	ctx := l.WithContext(context.Background())
+
+	w := httptest.NewRecorder()
+	HTTPErrorResponseContext(ctx, w, E(Validation, Parameter("some_param"), errors.New("some error")))
+
+	if got := w.Result().StatusCode; got != http.StatusBadRequest {
+		t.Errorf("StatusCode = %v, want %v", got, http.StatusBadRequest)
+	}
+	if got := b.String(); !strings.Contains(got, `"request_id":"c0ffee"`) {
+		t.Errorf("error log = %s, want request_id from context logger", got)
+	}
+}
+
+func TestHTTPErrorResponseRequest_RequestID(t *testing.T) {
+	var b bytes.Buffer
+	l := logger.NewLogger(&b, zerolog.DebugLevel, false)
+	ctx := NewRequestIDContext(l.WithContext(context.Background()), "c0ffee")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user?x=y", nil).WithContext(ctx)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"typical", E(Validation, Parameter("some_param"), errors.New("some error"))},
+		{"internal", E(Internal, errors.New("some secret"))},
+		{"other", errors.New("some error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.Reset()
+			w := httptest.NewRecorder()
+			HTTPErrorResponseRequest(w, req, tt.err)
+
+			if got := w.Header().Get(RequestIDHeader); got != "c0ffee" {
+				t.Errorf("%s = %q, want c0ffee", RequestIDHeader, got)
+			}
+			var er ErrResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &er); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if er.Error.RequestID != "c0ffee" {
+				t.Errorf("RequestID = %q, want c0ffee", er.Error.RequestID)
+			}
+			for _, want := range []string{`"method":"POST"`, `"path":"/api/v1/user"`} {
+				if got := b.String(); !strings.Contains(got, want) {
+					t.Errorf("error log = %s, want it to contain %s", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// StatusClientClosedRequest is the (non-standard) HTTP status code
+// sent for errors of Kind Canceled, the client having gone away
+const StatusClientClosedRequest = 499
+
+// kindInfo holds the registered details of a Kind
+type kindInfo struct {
+	// name is returned by Kind.String and sent as the kind of
+	// the error response
+	name string
+	// status is the HTTP status code of the error response
+	status int
+	// expose is true if the error message is sent to the client,
+	// otherwise a generic message is sent
+	expose bool
+}
+
+// kinds is the registry of Kinds, seeded with the built-in Kinds
+var (
+	kindsMu sync.RWMutex
+	kinds   = map[Kind]kindInfo{
+		Other:           {"other_error", http.StatusInternalServerError, true},
+		Invalid:         {"invalid_operation", http.StatusBadRequest, true},
+		IO:              {"I/O_error", http.StatusInternalServerError, true},
+		Exist:           {"item_already_exists", http.StatusConflict, true},
+		NotExist:        {"item_does_not_exist", http.StatusNotFound, true},
+		Private:         {"information_withheld", http.StatusBadRequest, true},
+		Internal:        {"internal_error", http.StatusInternalServerError, false},
+		BrokenLink:      {"link_target_does_not_exist", http.StatusBadRequest, true},
+		Database:        {"database_error", http.StatusInternalServerError, false},
+		Validation:      {"input_validation_error", http.StatusBadRequest, true},
+		Unanticipated:   {"unanticipated_error", http.StatusInternalServerError, true},
+		InvalidRequest:  {"invalid_request_error", http.StatusBadRequest, true},
+		Conflict:        {"conflict_error", http.StatusConflict, true},
+		TooManyRequests: {"too_many_requests", http.StatusTooManyRequests, true},
+		Unavailable:     {"service_unavailable", http.StatusServiceUnavailable, true},
+		Timeout:         {"timeout_error", http.StatusGatewayTimeout, false},
+		Canceled:        {"request_canceled", StatusClientClosedRequest, false},
+		TooLarge:        {"request_too_large", http.StatusRequestEntityTooLarge, true},
+	}
+
+	// kindNames indexes kinds by name for ParseKind, so each name
+	// maps to exactly one Kind. It is guarded by kindsMu
+	kindNames = make(map[string]Kind, len(kinds))
+)
+
+func init() {
+	for k, ki := range kinds {
+		kindNames[ki.name] = k
+	}
+}
+
+// RegisterKind registers a Kind with the name returned by its String
+// method, the HTTP status code sent when an error of the Kind is
+// returned by HTTPErrorResponse, and whether the error message is
+// exposed to the client (if not, a generic message is sent and the
+// message is only logged). Application Kinds should use values
+// from 128 up so they do not clash with Kinds added to this package
+// later. Registering a built-in Kind replaces its mapping. RegisterKind
+// is meant to be called at startup, e.g. from an init function. It
+// panics if name is already registered to a different Kind, as
+// ParseKind could not tell the two apart.
+func RegisterKind(k Kind, name string, status int, expose bool) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+
+	if other, ok := kindNames[name]; ok && other != k {
+		panic("errs: RegisterKind called twice for name " + name)
+	}
+	if old, ok := kinds[k]; ok && kindNames[old.name] == k {
+		delete(kindNames, old.name)
+	}
+	kinds[k] = kindInfo{name: name, status: status, expose: expose}
+	kindNames[name] = k
+}
+
+// ParseKind returns the registered Kind with the given name, the
+// reverse of Kind.String, e.g. to rebuild an error received from
+// another service. ok is false if no Kind has the name.
+func ParseKind(name string) (k Kind, ok bool) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	if k, ok := kindNames[name]; ok {
+		return k, true
+	}
+	return Other, false
+}
+
+// lookupKind returns the registered details of k
+func lookupKind(k Kind) (kindInfo, bool) {
+	kindsMu.RLock()
+	ki, ok := kinds[k]
+	kindsMu.RUnlock()
+	return ki, ok
+}
+
+// contextErrKind returns the Kind for err if it is (or wraps) one
+// of the context package errors
+func contextErrKind(err error) (Kind, bool) {
+	switch {
+	case err == nil:
+		return Other, false
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout, true
+	case errors.Is(err, context.Canceled):
+		return Canceled, true
+	}
+	return Other, false
+}
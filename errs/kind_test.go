@@ -0,0 +1,123 @@
+package errs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func TestRegisterKind(t *testing.T) {
+	const PaymentRequired Kind = 128
+	RegisterKind(PaymentRequired, "payment_required", http.StatusPaymentRequired, false)
+	defer func() {
+		kindsMu.Lock()
+		delete(kinds, PaymentRequired)
+		delete(kindNames, "payment_required")
+		kindsMu.Unlock()
+	}()
+
+	if got := PaymentRequired.String(); got != "payment_required" {
+		t.Errorf("String() = %q, want payment_required", got)
+	}
+
+	w := httptest.NewRecorder()
+	HTTPErrorResponse(w, zerolog.Nop(), E(PaymentRequired, "card declined: insufficient funds"))
+
+	if w.Code != http.StatusPaymentRequired {
+		t.Errorf("StatusCode = %d, want %d", w.Code, http.StatusPaymentRequired)
+	}
+	var er ErrResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &er); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if er.Error.Message == "card declined: insufficient funds" {
+		t.Error("message of a Kind registered with expose false was sent to the client")
+	}
+}
+
+func TestRegisterKind_DuplicateName(t *testing.T) {
+	const Teapot Kind = 129
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterKind() did not panic for a name registered to another Kind")
+		}
+		if k, ok := ParseKind("conflict_error"); !ok || k != Conflict {
+			t.Errorf("ParseKind(conflict_error) = %v, %v, want %v", k, ok, Conflict)
+		}
+		kindsMu.RLock()
+		_, ok := kinds[Teapot]
+		kindsMu.RUnlock()
+		if ok {
+			t.Error("Kind registered despite its duplicate name")
+		}
+	}()
+	RegisterKind(Teapot, "conflict_error", http.StatusTeapot, true)
+}
+
+func TestContextErrKind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		err    error
+		kind   Kind
+		status int
+	}{
+		{"E deadline exceeded", E(context.DeadlineExceeded), Timeout, http.StatusGatewayTimeout},
+		{"E wrapped canceled", E(fmt.Errorf("query: %w", ctx.Err())), Canceled, StatusClientClosedRequest},
+		{"E explicit Kind kept", E(Unavailable, context.DeadlineExceeded), Unavailable, http.StatusServiceUnavailable},
+		{"plain deadline exceeded", errors.WithStack(context.DeadlineExceeded), Timeout, http.StatusGatewayTimeout},
+		{"inner Kind kept", E(Op("svc.Get"), E(Database, context.DeadlineExceeded)), Database, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if e, ok := tt.err.(*Error); ok && e.Kind != tt.kind {
+				t.Errorf("Kind = %v, want %v", e.Kind, tt.kind)
+			}
+
+			w := httptest.NewRecorder()
+			HTTPErrorResponse(w, zerolog.Nop(), tt.err)
+			if w.Code != tt.status {
+				t.Errorf("StatusCode = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+// a context error wrapped in an *Error with a hidden Kind must not
+// have its message (e.g. a query) sent to the client
+func TestContextErrKind_WrappedDatabase(t *testing.T) {
+	const secret = "select * from secret_table where ssn=123"
+	err := E(Op("svc.Get"), E(Database, errors.Wrap(context.DeadlineExceeded, secret)))
+
+	if !KindIs(Database, err) {
+		t.Errorf("Kind = %v, want %v", err.(*Error).Kind, Database)
+	}
+
+	for _, tt := range []struct {
+		name string
+		err  error
+	}{
+		{"wrapped database", err},
+		{"plain context error", errors.Wrap(context.DeadlineExceeded, secret)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			HTTPErrorResponse(w, zerolog.Nop(), tt.err)
+			if body := w.Body.String(); strings.Contains(body, "secret_table") {
+				t.Errorf("response = %s, want the message hidden", body)
+			}
+			if _, se, _ := NewServiceError(tt.err); strings.Contains(se.Message, "secret_table") {
+				t.Errorf("NewServiceError() message = %q, want the message hidden", se.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package errs
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Format is the format of the error response body
+type Format uint8
+
+// Error response formats
+const (
+	// DefaultFormat is the {"error":{"kind":...}} body (ErrResponse)
+	DefaultFormat Format = iota
+	// ProblemFormat is an RFC 7807 (RFC 9457) Problem Details body
+	// sent as application/problem+json
+	ProblemFormat
+	// NegotiateFormat sends ProblemFormat if the request Accept
+	// header prefers application/problem+json and DefaultFormat
+	// otherwise. Negotiation needs the request, so errors sent with
+	// HTTPErrorResponse or HTTPErrorResponseContext use DefaultFormat
+	NegotiateFormat
+)
+
+// ProblemContentType is the media type of Problem Details responses
+const ProblemContentType = "application/problem+json"
+
+// responseConfig holds the package wide error response settings
+var responseConfig struct {
+	mu              sync.RWMutex
+	format          Format
+	problemTypeBase string
+	catalog         *Catalog
+	reporter        Reporter
+}
+
+// SetResponseFormat sets the format of all error response bodies.
+// It is meant to be called once at startup; the default is
+// DefaultFormat.
+func SetResponseFormat(f Format) {
+	responseConfig.mu.Lock()
+	responseConfig.format = f
+	responseConfig.mu.Unlock()
+}
+
+// SetProblemTypeBase sets the base URI used to build the type member
+// of Problem Details responses. The error Kind is appended to base,
+// e.g. "https://example.com/problems/" gives a type of
+// "https://example.com/problems/input_validation_error". If base is
+// empty (the default), type is "about:blank".
+func SetProblemTypeBase(base string) {
+	responseConfig.mu.Lock()
+	responseConfig.problemTypeBase = base
+	responseConfig.mu.Unlock()
+}
+
+// responseOpts holds the details of how an error response for a
+// particular request is written
+type responseOpts struct {
+	format         Format
+	acceptLanguage string
+	catalog        *Catalog
+	reporter       Reporter
+	// requestID, method and path describe the request, if known
+	requestID string
+	method    string
+	path      string
+	// panic is true if the error was recovered from a panic
+	panic bool
+}
+
+// newResponseOpts returns the responseOpts for a request. accept and
+// acceptLanguage are the request Accept and Accept-Language headers,
+// either of which may be empty
+func newResponseOpts(accept, acceptLanguage string) responseOpts {
+	responseConfig.mu.RLock()
+	f := responseConfig.format
+	c := responseConfig.catalog
+	r := responseConfig.reporter
+	responseConfig.mu.RUnlock()
+
+	if f == NegotiateFormat {
+		f = negotiateFormat(accept)
+	}
+
+	return responseOpts{format: f, acceptLanguage: acceptLanguage, catalog: c, reporter: r}
+}
+
+// message returns the catalog message for code, or msg if there is
+// no catalog or code is not in it
+func (ro responseOpts) message(code Code, param Parameter, msg string) string {
+	if ro.catalog == nil || code == "" {
+		return msg
+	}
+	if m, ok := ro.catalog.Message(code, param, ro.acceptLanguage); ok {
+		return m
+	}
+	return msg
+}
+
+// negotiateFormat returns ProblemFormat if the Accept header accepts
+// application/problem+json at least as much as application/json
+func negotiateFormat(accept string) Format {
+	var qProblem, qJSON float64
+	for _, r := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mt {
+		case ProblemContentType:
+			qProblem = q
+		case "application/json":
+			qJSON = q
+		}
+	}
+
+	if qProblem > 0 && qProblem >= qJSON {
+		return ProblemFormat
+	}
+	return DefaultFormat
+}
+
+// Problem is an RFC 7807 (RFC 9457) Problem Details response body.
+// Kind, Code, Param and Errors are extension members carrying the
+// same values as the ServiceError of the default format
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Param    string `json:"param,omitempty"`
+	// Errors holds each field error of a ValidationErrors
+	Errors []FieldErrorResponse `json:"errors,omitempty"`
+}
+
+// newProblem returns the Problem for a ServiceError sent with the
+// given HTTP status code
+func newProblem(status int, se ServiceError, instance string) Problem {
+	responseConfig.mu.RLock()
+	base := responseConfig.problemTypeBase
+	responseConfig.mu.RUnlock()
+
+	typ := "about:blank"
+	if base != "" && se.Kind != "" {
+		typ = base + se.Kind
+	}
+
+	return Problem{
+		Type:     typ,
+		Title:    statusText(status),
+		Status:   status,
+		Detail:   se.Message,
+		Instance: instance,
+		Kind:     se.Kind,
+		Code:     se.Code,
+		Param:    se.Param,
+		Errors:   se.Errors,
+	}
+}
+
+// statusText returns the text for an HTTP status code, including
+// StatusClientClosedRequest
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+// writeErrResponse writes the error response headers, status code
+// and body in the format set in ro
+func writeErrResponse(w http.ResponseWriter, status int, er ErrResponse, ro responseOpts) {
+	var (
+		body        []byte
+		contentType string
+	)
+
+	er.Error.RequestID = ro.requestID
+
+	switch ro.format {
+	case ProblemFormat:
+		body, _ = json.Marshal(newProblem(status, er.Error, ro.requestID))
+		contentType = ProblemContentType
+	default:
+		body, _ = json.Marshal(er)
+		contentType = "application/json"
+	}
+
+	// Write Content-Type headers
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Write HTTP Statuscode
+	w.WriteHeader(status)
+
+	// Write response body (json)
+	fmt.Fprintln(w, string(body))
+}
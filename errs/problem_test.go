@@ -0,0 +1,109 @@
+package errs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func Test_negotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Format
+	}{
+		{"", DefaultFormat},
+		{"*/*", DefaultFormat},
+		{"application/json", DefaultFormat},
+		{"application/problem+json", ProblemFormat},
+		{"application/json, application/problem+json", ProblemFormat},
+		{"application/problem+json;q=0.5, application/json", DefaultFormat},
+		{"application/problem+json;q=0", DefaultFormat},
+		{"application/problem+json; q=0.9, application/json; q=0.8", ProblemFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := negotiateFormat(tt.accept); got != tt.want {
+				t.Errorf("negotiateFormat(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPErrorResponseRequest_Problem(t *testing.T) {
+	SetResponseFormat(NegotiateFormat)
+	SetProblemTypeBase("https://example.com/problems/")
+	defer func() {
+		SetResponseFormat(DefaultFormat)
+		SetProblemTypeBase("")
+	}()
+
+	err := E(Validation, Parameter("some_param"), Code("some_code"), errors.New("some error"))
+
+	l := zerolog.Nop()
+	ctx := NewRequestIDContext(l.WithContext(context.Background()), "c0ffee")
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	req.Header.Set("Accept", ProblemContentType)
+
+	w := httptest.NewRecorder()
+	HTTPErrorResponseRequest(w, req, err)
+
+	if ct := w.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ProblemContentType)
+	}
+
+	var got Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	want := Problem{
+		Type:     "https://example.com/problems/input_validation_error",
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   "some error",
+		Instance: "c0ffee",
+		Kind:     "input_validation_error",
+		Code:     "some_code",
+		Param:    "some_param",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Problem = %+v, want %+v", got, want)
+	}
+
+	// without the Accept header, the default format is kept
+	req.Header.Del("Accept")
+	w = httptest.NewRecorder()
+	HTTPErrorResponseRequest(w, req, err)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+}
+
+func TestHTTPErrorResponse_ProblemFormat(t *testing.T) {
+	SetResponseFormat(ProblemFormat)
+	defer SetResponseFormat(DefaultFormat)
+
+	w := httptest.NewRecorder()
+	HTTPErrorResponse(w, zerolog.Nop(), errors.New("some error"))
+
+	var got Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	want := Problem{
+		Type:   "about:blank",
+		Title:  "Internal Server Error",
+		Status: http.StatusInternalServerError,
+		Detail: "Unexpected error - contact support",
+		Kind:   "unanticipated_error",
+		Code:   "Unanticipated",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Problem = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package errs
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Report describes a server side error (one sent with a 5xx status
+// code) or a panic, for a Reporter
+type Report struct {
+	// Err is the error sent in the response
+	Err error
+	// Chain is Err followed by each error it wraps, outermost first
+	Chain []error
+	// Stack is the pkg/errors stack trace of the innermost error in
+	// Chain which has one, if any
+	Stack errors.StackTrace
+	// Kind, Code and User are those of the *Error in Chain, if any
+	Kind Kind
+	Code Code
+	User UserName
+	// Status is the HTTP status code of the response
+	Status int
+	// Panic is true if the error was recovered from a panic by Recover
+	Panic bool
+	// RequestID, Method and Path describe the request, if known
+	RequestID string
+	Method    string
+	Path      string
+	// Time is when the error was reported
+	Time time.Time
+}
+
+// Reporter is told about server side errors and panics, e.g. to
+// send them to an error tracking service. Report is called before
+// the error response is written, so it should not block.
+type Reporter interface {
+	Report(r Report)
+}
+
+// SetReporter sets the Reporter called for each error response with
+// a 5xx status code and each panic recovered by Recover. Pass nil
+// (the default) to stop reporting. It is meant to be called once at
+// startup.
+func SetReporter(r Reporter) {
+	responseConfig.mu.Lock()
+	responseConfig.reporter = r
+	responseConfig.mu.Unlock()
+}
+
+// report sends err to the Reporter in ro, if any and the status is
+// a server side one
+func (ro responseOpts) report(err error, status int) {
+	if ro.reporter == nil || status < http.StatusInternalServerError {
+		return
+	}
+	ro.reporter.Report(newReport(err, status, ro))
+}
+
+// newReport returns the Report for err
+func newReport(err error, status int, ro responseOpts) Report {
+	r := Report{
+		Err:       err,
+		Status:    status,
+		Panic:     ro.panic,
+		RequestID: ro.requestID,
+		Method:    ro.method,
+		Path:      ro.path,
+		Stack:     stackTrace(err),
+		Time:      time.Now(),
+	}
+
+	var kindSet bool
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		r.Chain = append(r.Chain, e)
+		if te, ok := e.(*Error); ok {
+			// the outermost *Error holds the Kind, Code and User
+			// pulled up by E
+			if !kindSet {
+				r.Kind, r.Code, r.User = te.Kind, te.Code, te.User
+				kindSet = true
+			}
+		}
+	}
+	if !kindSet {
+		if k, ok := contextErrKind(err); ok {
+			r.Kind = k
+		} else {
+			r.Kind = Unanticipated
+		}
+	}
+
+	return r
+}
+
+// errsPkg is the import path of this package
+var errsPkg = reflect.TypeOf(Error{}).PkgPath()
+
+// TopFrame returns the function, file and line of the frame of the
+// Report stack where the error was created, skipping the runtime
+// and the functions of this package which build errors (E and
+// Recover). ok is false if there is no stack.
+func (r Report) TopFrame() (function, file string, line int, ok bool) {
+	for _, f := range r.Stack {
+		pc := uintptr(f) - 1
+		fn := runtime.FuncForPC(pc)
+		if fn == nil {
+			continue
+		}
+		name := fn.Name()
+		if strings.HasPrefix(name, "runtime.") ||
+			name == errsPkg+".E" ||
+			strings.HasPrefix(name, errsPkg+".Recover") {
+			continue
+		}
+		file, line = fn.FileLine(pc)
+		return name, file, line, true
+	}
+	return "", "", 0, false
+}
+
+// Recover is middleware which recovers from panics in h. The panic is
+// sent to the Reporter set with SetReporter (with Report.Panic set)
+// and the client gets an Internal error response, written with
+// HTTPErrorResponseRequest. Use it inside the httplog middleware so
+// the request id is known. http.ErrAbortHandler panics are not
+// recovered.
+func Recover(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			var err error
+			if pe, ok := p.(error); ok {
+				err = errors.Wrap(pe, "panic")
+			} else {
+				err = errors.New(fmt.Sprintf("panic: %v", p))
+			}
+
+			ro := newRequestResponseOpts(req)
+			ro.panic = true
+			httpErrorResponse(w, zerolog.Ctx(req.Context()).With().Bool("panic", true).Logger(), E(Internal, err), ro)
+		}()
+		h.ServeHTTP(w, req)
+	})
+}
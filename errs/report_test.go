@@ -0,0 +1,146 @@
+package errs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// recordingReporter keeps each Report it is sent
+type recordingReporter struct {
+	reports []Report
+}
+
+func (rr *recordingReporter) Report(r Report) {
+	rr.reports = append(rr.reports, r)
+}
+
+func newReportRequest() *http.Request {
+	l := zerolog.Nop()
+	ctx := NewRequestIDContext(l.WithContext(context.Background()), "c0ffee")
+	return httptest.NewRequest(http.MethodGet, "/api/v1/user", nil).WithContext(ctx)
+}
+
+func TestReporter(t *testing.T) {
+	rr := new(recordingReporter)
+	SetReporter(rr)
+	defer SetReporter(nil)
+
+	req := newReportRequest()
+
+	// client errors are not reported
+	HTTPErrorResponseRequest(httptest.NewRecorder(), req, E(Validation, "bad input"))
+	if len(rr.reports) != 0 {
+		t.Fatalf("got %d reports for a 400, want 0", len(rr.reports))
+	}
+
+	err := E(Database, UserName("repoman"), Code("db_down"), errors.New("connection refused"))
+	HTTPErrorResponseRequest(httptest.NewRecorder(), req, err)
+	if len(rr.reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(rr.reports))
+	}
+
+	r := rr.reports[0]
+	if r.Kind != Database || r.Code != "db_down" || r.User != "repoman" || r.Status != http.StatusInternalServerError {
+		t.Errorf("Report = %+v", r)
+	}
+	if r.RequestID != "c0ffee" || r.Method != http.MethodGet || r.Path != "/api/v1/user" {
+		t.Errorf("Report request = %s %s %s", r.RequestID, r.Method, r.Path)
+	}
+	if len(r.Chain) < 2 || r.Chain[0] != err {
+		t.Errorf("Report Chain = %v", r.Chain)
+	}
+	if r.Panic {
+		t.Error("Report Panic = true, want false")
+	}
+	fn, _, _, ok := r.TopFrame()
+	if !ok || !strings.HasSuffix(fn, ".TestReporter") {
+		t.Errorf("TopFrame() = %q, %v, want TestReporter", fn, ok)
+	}
+
+	// errors which are not an *Error are Unanticipated
+	HTTPErrorResponseRequest(httptest.NewRecorder(), req, errors.New("some error"))
+	if got := rr.reports[1].Kind; got != Unanticipated {
+		t.Errorf("Report Kind = %v, want %v", got, Unanticipated)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	rr := new(recordingReporter)
+	SetReporter(rr)
+	defer SetReporter(nil)
+
+	h := Recover(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newReportRequest())
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if len(rr.reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(rr.reports))
+	}
+	r := rr.reports[0]
+	if !r.Panic || r.Kind != Internal || r.RequestID != "c0ffee" {
+		t.Errorf("Report = %+v", r)
+	}
+	if !strings.Contains(r.Err.Error(), "assignment to entry in nil map") {
+		t.Errorf("Report Err = %v", r.Err)
+	}
+	fn, _, _, ok := r.TopFrame()
+	if !ok || !strings.Contains(fn, ".TestRecover.") {
+		t.Errorf("TopFrame() = %q, %v, want the panicking handler", fn, ok)
+	}
+}
+
+func TestGroupReporter(t *testing.T) {
+	g := NewGroupReporter()
+	SetReporter(g)
+	defer SetReporter(nil)
+
+	req := newReportRequest()
+	for i := 0; i < 3; i++ {
+		HTTPErrorResponseRequest(httptest.NewRecorder(), req, E(Internal, Code("a"), "failed"))
+	}
+	HTTPErrorResponseRequest(httptest.NewRecorder(), req, E(Internal, Code("b"), "failed"))
+
+	groups := g.Groups()
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+	counts := map[string]int{}
+	for _, eg := range groups {
+		counts[eg.Code] = eg.Count
+		if eg.FirstSeen.After(eg.LastSeen) || eg.Frame == "" || eg.RequestID != "c0ffee" {
+			t.Errorf("group = %+v", eg)
+		}
+	}
+	if counts["a"] != 3 || counts["b"] != 1 {
+		t.Errorf("counts = %v, want a:3 b:1", counts)
+	}
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/errors", nil))
+	var got []ErrorGroup
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Code != "b" {
+		t.Errorf("ServeHTTP() = %+v, want the latest group first", got)
+	}
+
+	g.Reset()
+	if len(g.Groups()) != 0 {
+		t.Error("Groups() after Reset() not empty")
+	}
+}
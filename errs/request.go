@@ -0,0 +1,25 @@
+package errs
+
+import "context"
+
+// RequestIDHeader is the response header error responses carry the
+// request id in, if it is known (see NewRequestIDContext)
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key for the unique id of the request
+var requestIDKey = contextKey("RequestID")
+
+// NewRequestIDContext returns a copy of ctx carrying id as the
+// unique id of the request being served. The httplog middleware
+// calls this for each request, so error responses written with the
+// context (or request) aware functions can refer to the request.
+func NewRequestIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request id set into ctx by
+// NewRequestIDContext. ok is false if there is none.
+func RequestIDFromContext(ctx context.Context) (id string, ok bool) {
+	id, ok = ctx.Value(requestIDKey).(string)
+	return id, ok
+}
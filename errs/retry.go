@@ -0,0 +1,119 @@
+package errs
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Retry is the retry metadata of an error, set by passing it to E.
+// It tells the client when it may retry the request and, for rate
+// limited requests, the limit it ran into. It is sent in the
+// Retry-After and RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers of TooManyRequests (429) and Unavailable
+// (503) error responses and logged with the error.
+type Retry struct {
+	// After is how long the client should wait before retrying
+	After time.Duration
+	// At is when the client may retry. If set, it is used instead
+	// of After
+	At time.Time
+	// Limit is the request quota of the current window. The
+	// RateLimit headers are only sent if Limit is set
+	Limit int
+	// Remaining is the quota left in the current window
+	Remaining int
+	// Reset is the time left until the quota is reset. If zero,
+	// the retry delay is used
+	Reset time.Duration
+}
+
+// RetryAfter returns a Retry telling the client to wait d before
+// retrying
+func RetryAfter(d time.Duration) Retry {
+	return Retry{After: d}
+}
+
+// RetryAt returns a Retry telling the client to retry at t
+func RetryAt(t time.Time) Retry {
+	return Retry{At: t}
+}
+
+// RetryOf returns the Retry of err, if err is (or wraps) an *Error
+// with one set
+func RetryOf(err error) (Retry, bool) {
+	for err != nil {
+		if e, ok := err.(*Error); ok && e.Retry != nil {
+			return *e.Retry, true
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return Retry{}, false
+}
+
+// delay returns how long from now the client should wait, never
+// less than zero
+func (r Retry) delay(now time.Time) time.Duration {
+	d := r.After
+	if !r.At.IsZero() {
+		d = r.At.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// setHeaders sets the Retry-After header and, if Limit is set, the
+// RateLimit headers of the IETF RateLimit header fields draft.
+// Retry-After is sent as an HTTP date if At is set, otherwise in
+// seconds, rounded up
+func (r Retry) setHeaders(h http.Header, now time.Time) {
+	if !r.At.IsZero() {
+		h.Set("Retry-After", r.At.UTC().Format(http.TimeFormat))
+	} else {
+		h.Set("Retry-After", strconv.FormatInt(seconds(r.After), 10))
+	}
+
+	if r.Limit <= 0 {
+		return
+	}
+	reset := r.Reset
+	if reset <= 0 {
+		reset = r.delay(now)
+	}
+	remaining := r.Remaining
+	if remaining < 0 {
+		remaining = 0
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(r.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("RateLimit-Reset", strconv.FormatInt(seconds(reset), 10))
+}
+
+// seconds returns d in whole seconds, rounded up, and never less
+// than zero
+func seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler
+func (r Retry) MarshalZerologObject(e *zerolog.Event) {
+	e.Dur("After", r.delay(time.Now()))
+	if !r.At.IsZero() {
+		e.Time("At", r.At)
+	}
+	if r.Limit > 0 {
+		e.Int("Limit", r.Limit).Int("Remaining", r.Remaining)
+	}
+}
@@ -0,0 +1,98 @@
+package errs
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func TestE_Retry(t *testing.T) {
+	inner := E(TooManyRequests, RetryAfter(time.Minute), "slow down")
+	err := E("outer", inner)
+
+	r, ok := RetryOf(err)
+	if !ok || r.After != time.Minute {
+		t.Errorf("RetryOf() = %+v, %v, want After %v", r, ok, time.Minute)
+	}
+	if _, ok := RetryOf(errors.New("no retry")); ok {
+		t.Error("RetryOf() ok = true, want false")
+	}
+}
+
+func TestHTTPErrorResponse_Retry(t *testing.T) {
+	at := time.Date(2021, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		err  error
+		want map[string]string
+	}{
+		{
+			name: "after",
+			err:  E(TooManyRequests, Retry{After: 1500 * time.Millisecond, Limit: 100, Remaining: 0, Reset: 30 * time.Second}, "rate limit exceeded"),
+			want: map[string]string{
+				"Retry-After":         "2",
+				"RateLimit-Limit":     "100",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "30",
+			},
+		},
+		{
+			name: "at",
+			err:  E(Unavailable, RetryAt(at), "down for maintenance"),
+			want: map[string]string{
+				"Retry-After":     "Thu, 21 Oct 2021 07:28:00 GMT",
+				"RateLimit-Limit": "",
+			},
+		},
+		{
+			name: "reset defaults to retry delay",
+			err:  E(TooManyRequests, Retry{After: 10 * time.Second, Limit: 5}, "rate limit exceeded"),
+			want: map[string]string{
+				"Retry-After":     "10",
+				"RateLimit-Reset": "10",
+			},
+		},
+		{
+			name: "not sent for other statuses",
+			err:  E(Validation, RetryAfter(time.Second), "bad input"),
+			want: map[string]string{
+				"Retry-After": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			HTTPErrorResponse(w, zerolog.Nop(), tt.err)
+			for k, v := range tt.want {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPErrorResponse_RetryLogged(t *testing.T) {
+	var b bytes.Buffer
+	l := zerolog.New(&b)
+	ctx := l.WithContext(context.Background())
+
+	w := httptest.NewRecorder()
+	HTTPErrorResponseContext(ctx, w, E(TooManyRequests, Retry{After: 2 * time.Second, Limit: 10, Remaining: 0}, "rate limit exceeded"))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := b.String(); !strings.Contains(got, `"Retry":{"After":2000,"Limit":10,"Remaining":0}`) {
+		t.Errorf("log = %s, want it to contain the Retry hint", got)
+	}
+}
@@ -0,0 +1,26 @@
+package errs
+
+import "context"
+
+type contextKey string
+
+func (c contextKey) String() string {
+	return "errs context key " + string(c)
+}
+
+// userKey is the context key for the UserName of the authenticated user
+var userKey = contextKey("User")
+
+// NewUserContext returns a copy of ctx carrying u as the
+// authenticated user. Errors built by E with this context as an
+// argument will have their User set to u.
+func NewUserContext(ctx context.Context, u UserName) context.Context {
+	return context.WithValue(ctx, userKey, u)
+}
+
+// UserFromContext returns the authenticated user set into ctx by
+// NewUserContext. ok is false if there is none.
+func UserFromContext(ctx context.Context) (u UserName, ok bool) {
+	u, ok = ctx.Value(userKey).(UserName)
+	return u, ok
+}
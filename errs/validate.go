@@ -0,0 +1,380 @@
+package errs
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Codes set on the field errors returned by Validate
+const (
+	RequiredCode      Code = "required"
+	ForbiddenCode     Code = "forbidden"
+	OutOfRangeCode    Code = "out_of_range"
+	InvalidFormatCode Code = "invalid_format"
+)
+
+// regexps caches the compiled regexp rules, keyed by pattern
+var regexps sync.Map
+
+// Validate checks the fields of the struct v (or pointer to struct)
+// against the rules in their validate struct tags, e.g.
+//
+//	type user struct {
+//		Email string `json:"email" validate:"required,email"`
+//		Name  string `json:"name" validate:"required,min=2,max=50"`
+//		Age   int    `json:"age" validate:"min=0,max=150"`
+//		Color string `json:"color" validate:"oneof=red green blue"`
+//		Code  string `json:"code" validate:"regexp=^[A-Z]{3}$"`
+//		ID    string `json:"id" validate:"forbidden"`
+//	}
+//
+// The rules are:
+//
+//	required   the field must not be its zero value (MissingField)
+//	forbidden  the field must be its zero value (InputUnwanted)
+//	min=n      numbers must be >= n; strings, slices and maps must
+//	           have a length >= n (OutOfRange)
+//	max=n      as min, for the upper bound (OutOfRange)
+//	oneof=a b  the value must be one of the space separated values
+//	           (InvalidFormat)
+//	email      the value must be an email address (InvalidFormat)
+//	regexp=re  the value must match re. As re may contain commas,
+//	           regexp must be the last rule in the tag (InvalidFormat)
+//
+// The string rules (length, oneof, email and regexp) are not
+// applied to empty strings; use required as well if the field must
+// be sent. Nil pointers are only checked by required. Nested structs
+// are validated too, their fields named parent.child; as in
+// encoding/json, the fields of an embedded struct without a json tag
+// name are named as if they were fields of the outer struct. A
+// pointer back to a struct already being validated is not followed.
+//
+// Each problem is a FieldError with Param set to the JSON name of the
+// field. If there are any, Validate returns an *Error of Kind
+// Validation wrapping them as ValidationErrors; if there is exactly
+// one, its Param and Code are also set on the *Error. The typed
+// errors (MissingField, InputUnwanted, OutOfRange and InvalidFormat)
+// can be retrieved with errors.As. An invalid tag returns an error
+// of Kind Internal.
+func Validate(v interface{}) error {
+	seen := make(map[uintptr]bool)
+	rv, _ := followPointers(reflect.ValueOf(v), seen)
+	if !rv.IsValid() || rv.Kind() == reflect.Ptr {
+		return E(Internal, "errs.Validate: nil value")
+	}
+	if rv.Kind() != reflect.Struct {
+		return E(Internal, fmt.Sprintf("errs.Validate: %s is not a struct", rv.Type()))
+	}
+
+	var verrs ValidationErrors
+	if err := validateStruct(rv, "", &verrs, seen); err != nil {
+		return E(Internal, err)
+	}
+
+	switch len(verrs) {
+	case 0:
+		return nil
+	case 1:
+		return E(Validation, verrs[0].Param, verrs[0].Code, verrs)
+	default:
+		return E(Validation, verrs)
+	}
+}
+
+// validateStruct validates the fields of rv, adding any problems
+// to verrs. prefix is prepended to the field names. The fields of
+// embedded structs without a json tag name are validated as if they
+// were fields of rv, as encoding/json promotes them. seen holds the
+// pointers being followed, so a struct that points back to itself
+// (e.g. a parent pointer) is not validated again
+func validateStruct(rv reflect.Value, prefix string, verrs *ValidationErrors, seen map[uintptr]bool) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		// as in encoding/json, embedded structs of unexported types
+		// are kept, they may have exported fields
+		embedded := sf.Anonymous && isStruct(sf.Type)
+		if sf.PkgPath != "" && !embedded { // unexported
+			continue
+		}
+		if jsonTagName(sf) != "" {
+			embedded = false
+		}
+		name := prefix + jsonName(sf)
+		fv := rv.Field(i)
+
+		if tag, ok := sf.Tag.Lookup("validate"); ok && tag != "" && tag != "-" && sf.PkgPath == "" {
+			if err := validateField(fv, name, tag, verrs); err != nil {
+				return err
+			}
+		}
+
+		structPrefix := name + "."
+		if embedded {
+			structPrefix = prefix
+		}
+
+		// descend into nested structs
+		if err := validateNested(fv, name, structPrefix, verrs, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNested validates fv if it is (or points to) a struct, or
+// each struct element if it is a slice or array. structPrefix is the
+// prefix for the fields of a struct, name that of the elements
+func validateNested(fv reflect.Value, name, structPrefix string, verrs *ValidationErrors, seen map[uintptr]bool) error {
+	fv, release := followPointers(fv, seen)
+	defer release()
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		return validateStruct(fv, structPrefix, verrs, seen)
+	case reflect.Slice, reflect.Array:
+		for j := 0; j < fv.Len(); j++ {
+			elem := fmt.Sprintf("%s[%d]", name, j)
+			if err := validateNested(fv.Index(j), elem, elem+".", verrs, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// followPointers dereferences v until it is not a non-nil pointer,
+// marking each pointer followed in seen. If a pointer is already in
+// seen (a cycle), the pointer itself is returned, so it is not
+// descended into. release unmarks the pointers once v is done with
+func followPointers(v reflect.Value, seen map[uintptr]bool) (_ reflect.Value, release func()) {
+	var marked []uintptr
+	release = func() {
+		for _, p := range marked {
+			delete(seen, p)
+		}
+	}
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		p := v.Pointer()
+		if seen[p] {
+			break
+		}
+		seen[p] = true
+		marked = append(marked, p)
+		v = v.Elem()
+	}
+	return v, release
+}
+
+// isStruct reports whether t is a struct or a pointer to one
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// jsonTagName returns the name set in the json tag of the field, if any
+func jsonTagName(sf reflect.StructField) string {
+	tag := sf.Tag.Get("json")
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "-" {
+		return ""
+	}
+	return tag
+}
+
+// jsonName returns the name of the field in JSON
+func jsonName(sf reflect.StructField) string {
+	if tag := jsonTagName(sf); tag != "" {
+		return tag
+	}
+	return sf.Name
+}
+
+// validateField applies the rules of tag to fv. Only the first
+// problem found with a field is reported
+func validateField(fv reflect.Value, name, tag string, verrs *ValidationErrors) error {
+	add := func(code Code, err error) {
+		*verrs = append(*verrs, FieldError{Param: Parameter(name), Code: code, Message: err.Error(), Err: err})
+	}
+
+	for _, rule := range splitRules(tag) {
+		key, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			key, arg = rule[:i], rule[i+1:]
+		}
+
+		switch key {
+		case "required":
+			if fv.IsZero() {
+				add(RequiredCode, MissingField(name))
+				return nil
+			}
+			continue
+		case "forbidden":
+			if !fv.IsZero() {
+				add(ForbiddenCode, InputUnwanted(name))
+				return nil
+			}
+			continue
+		}
+
+		// the remaining rules apply to the value pointed to
+		v := fv
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.String && v.Len() == 0 {
+			continue
+		}
+
+		var (
+			err  error
+			code Code
+		)
+		switch key {
+		case "min", "max":
+			code = OutOfRangeCode
+			err = checkRange(v, name, key, arg)
+		case "oneof":
+			code = InvalidFormatCode
+			err = checkOneOf(v, name, arg)
+		case "email":
+			code = InvalidFormatCode
+			err = checkEmail(v, name)
+		case "regexp":
+			code = InvalidFormatCode
+			err = checkRegexp(v, name, arg)
+		default:
+			return fmt.Errorf("errs.Validate: unknown rule %q on %s", key, name)
+		}
+
+		switch err.(type) {
+		case nil:
+			continue
+		case OutOfRange, InvalidFormat:
+			add(code, err)
+			return nil
+		default:
+			// an invalid tag
+			return err
+		}
+	}
+	return nil
+}
+
+// splitRules splits a validate tag into its rules. A regexp rule
+// takes the rest of the tag
+func splitRules(tag string) []string {
+	var rules []string
+	for tag != "" {
+		if strings.HasPrefix(tag, "regexp=") {
+			return append(rules, tag)
+		}
+		i := strings.Index(tag, ",")
+		if i < 0 {
+			return append(rules, tag)
+		}
+		rules = append(rules, tag[:i])
+		tag = tag[i+1:]
+	}
+	return rules
+}
+
+// checkRange checks v against a min or max rule
+func checkRange(v reflect.Value, name, key, arg string) error {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return fmt.Errorf("errs.Validate: invalid %s=%q on %s", key, arg, name)
+	}
+
+	var (
+		n      float64
+		length bool
+	)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	case reflect.String:
+		n, length = float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n, length = float64(v.Len()), true
+	default:
+		return fmt.Errorf("errs.Validate: %s does not apply to %s (%s)", key, name, v.Kind())
+	}
+
+	if (key == "min" && n >= bound) || (key == "max" && n <= bound) {
+		return nil
+	}
+
+	oor := OutOfRange{Field: name, Length: length}
+	if key == "min" {
+		oor.Min = arg
+	} else {
+		oor.Max = arg
+	}
+	return oor
+}
+
+// checkOneOf checks v is one of the space separated values in arg
+func checkOneOf(v reflect.Value, name, arg string) error {
+	allowed := strings.Fields(arg)
+	// fmt prints the value a reflect.Value holds, and unlike
+	// Interface it works for fields promoted from unexported types
+	s := fmt.Sprint(v)
+	for _, a := range allowed {
+		if s == a {
+			return nil
+		}
+	}
+	return InvalidFormat{Field: name, Want: "one of " + strings.Join(allowed, ", ")}
+}
+
+// checkEmail checks v is a bare email address
+func checkEmail(v reflect.Value, name string) error {
+	if v.Kind() != reflect.String {
+		return fmt.Errorf("errs.Validate: email does not apply to %s (%s)", name, v.Kind())
+	}
+	a, err := mail.ParseAddress(v.String())
+	if err != nil || a.Address != v.String() {
+		return InvalidFormat{Field: name, Want: "a valid email address"}
+	}
+	return nil
+}
+
+// checkRegexp checks v matches the pattern
+func checkRegexp(v reflect.Value, name, pattern string) error {
+	if v.Kind() != reflect.String {
+		return fmt.Errorf("errs.Validate: regexp does not apply to %s (%s)", name, v.Kind())
+	}
+
+	re, ok := regexps.Load(pattern)
+	if !ok {
+		c, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("errs.Validate: invalid regexp on %s: %v", name, err)
+		}
+		re, _ = regexps.LoadOrStore(pattern, c)
+	}
+
+	if !re.(*regexp.Regexp).MatchString(v.String()) {
+		return InvalidFormat{Field: name, Want: "in the format " + pattern}
+	}
+	return nil
+}
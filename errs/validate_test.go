@@ -0,0 +1,187 @@
+package errs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testAddress struct {
+	Zip string `json:"zip" validate:"required,regexp=^[0-9]{5}$"`
+}
+
+type testUser struct {
+	ID       string         `json:"id" validate:"forbidden"`
+	Email    string         `json:"email" validate:"required,email"`
+	Name     string         `json:"name,omitempty" validate:"required,min=2,max=5"`
+	Age      int            `json:"age" validate:"min=0,max=150"`
+	Color    string         `json:"color" validate:"oneof=red green blue"`
+	Nickname *string        `json:"nickname" validate:"max=3"`
+	Tags     []string       `json:"tags" validate:"max=2"`
+	Address  *testAddress   `json:"address" validate:"required"`
+	Others   []testAddress  `json:"others"`
+	Extra    map[string]int `json:"-" validate:"max=1"`
+	internal string         `validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	long := "longer"
+
+	valid := testUser{
+		Email:   "otto@example.com",
+		Name:    "Otto",
+		Age:     42,
+		Color:   "red",
+		Address: &testAddress{Zip: "60614"},
+	}
+	if err := Validate(&valid); err != nil {
+		t.Fatalf("Validate(valid) error = %v", err)
+	}
+
+	invalid := testUser{
+		ID:       "1",
+		Email:    "Otto <otto@example.com>",
+		Name:     "O",
+		Age:      200,
+		Color:    "pink",
+		Nickname: &long,
+		Tags:     []string{"a", "b", "c"},
+		Others:   []testAddress{{Zip: "606"}},
+		Extra:    map[string]int{"a": 1, "b": 2},
+	}
+	err := Validate(invalid)
+
+	e, ok := err.(*Error)
+	if !ok || e.Kind != Validation {
+		t.Fatalf("Validate() = %#v, want *Error of Kind Validation", err)
+	}
+
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatal("errors.As(ValidationErrors) = false")
+	}
+	type result struct {
+		Param string
+		Code  Code
+		Msg   string
+	}
+	var got []result
+	for _, fe := range verrs {
+		got = append(got, result{string(fe.Param), fe.Code, fe.Message})
+	}
+	want := []result{
+		{"id", ForbiddenCode, "id has a value, but should be nil"},
+		{"email", InvalidFormatCode, "email must be a valid email address"},
+		{"name", OutOfRangeCode, "name must be at least 2 characters or items long"},
+		{"age", OutOfRangeCode, "age must be at most 150"},
+		{"color", InvalidFormatCode, "color must be one of red, green, blue"},
+		{"nickname", OutOfRangeCode, "nickname must be at most 3 characters or items long"},
+		{"tags", OutOfRangeCode, "tags must be at most 2 characters or items long"},
+		{"address", RequiredCode, "address is required"},
+		{"others[0].zip", InvalidFormatCode, "others[0].zip must be in the format ^[0-9]{5}$"},
+		{"Extra", OutOfRangeCode, "Extra must be at most 1 characters or items long"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() field errors =\n%v\nwant\n%v", got, want)
+	}
+
+	// the typed errors can be found with errors.As
+	var iu InputUnwanted
+	if !errors.As(err, &iu) || iu != "id" {
+		t.Errorf("errors.As(InputUnwanted) = %q", iu)
+	}
+	var oor OutOfRange
+	if !errors.As(err, &oor) || oor.Field != "name" {
+		t.Errorf("errors.As(OutOfRange) = %+v", oor)
+	}
+}
+
+func TestValidate_Single(t *testing.T) {
+	err := Validate(testAddress{})
+
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Validate() = %#v, want *Error", err)
+	}
+	if e.Kind != Validation || e.Param != "zip" || e.Code != RequiredCode {
+		t.Errorf("Validate() = Kind %v, Param %q, Code %q", e.Kind, e.Param, e.Code)
+	}
+	var mf MissingField
+	if !errors.As(err, &mf) || mf != "zip" {
+		t.Errorf("errors.As(MissingField) = %q, want zip", mf)
+	}
+}
+
+func TestValidate_BadTag(t *testing.T) {
+	type bad struct {
+		N int `validate:"min=abc"`
+	}
+	if err := Validate(bad{}); !KindIs(Internal, err) {
+		t.Errorf("Validate() = %v, want Internal error", err)
+	}
+	if err := Validate("not a struct"); !KindIs(Internal, err) {
+		t.Errorf("Validate() = %v, want Internal error", err)
+	}
+}
+
+type testBase struct {
+	ID string `json:"id" validate:"required"`
+}
+
+type testAudited struct {
+	By   string `json:"by" validate:"required"`
+	Role string `json:"role" validate:"oneof=admin user"`
+}
+
+type testNode struct {
+	Name   string    `json:"name" validate:"required"`
+	Parent *testNode `json:"parent"`
+}
+
+func TestValidate_Embedded(t *testing.T) {
+	type user struct {
+		testBase
+		*testAudited
+		Meta testBase `json:"meta"`
+		Name string   `json:"name" validate:"required"`
+	}
+	type tagged struct {
+		testBase `json:"base"`
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want []Parameter
+	}{
+		{"promoted fields", user{testAudited: &testAudited{Role: "root"}}, []Parameter{"id", "by", "role", "meta.id", "name"}},
+		{"tagged embedded struct", tagged{}, []Parameter{"base.id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var verrs ValidationErrors
+			if !errors.As(Validate(tt.v), &verrs) {
+				t.Fatalf("Validate() did not return ValidationErrors")
+			}
+			var got []Parameter
+			for _, fe := range verrs {
+				got = append(got, fe.Param)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() params = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_Cycle(t *testing.T) {
+	n := &testNode{}
+	n.Parent = n
+
+	err := Validate(n)
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 1 || verrs[0].Param != "name" {
+		t.Errorf("Validate() = %v, want a single name error", err)
+	}
+}
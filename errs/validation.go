@@ -1,5 +1,12 @@
 package errs
 
+import (
+	"errors"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
 // MissingField is an error type that can be used when
 // validating input fields that do not have a value, but should
 type MissingField string
@@ -15,3 +22,113 @@ type InputUnwanted string
 func (e InputUnwanted) Error() string {
 	return string(e) + " has a value, but should be nil"
 }
+
+// OutOfRange is an error type that can be used when validating
+// input fields whose value (or length, if Length is true) is outside
+// the allowed range. Min or Max is empty if that end is unbounded
+type OutOfRange struct {
+	Field  string
+	Min    string
+	Max    string
+	Length bool
+}
+
+func (e OutOfRange) Error() string {
+	var r string
+	switch {
+	case e.Min != "" && e.Max != "":
+		r = "between " + e.Min + " and " + e.Max
+	case e.Min != "":
+		r = "at least " + e.Min
+	default:
+		r = "at most " + e.Max
+	}
+	if e.Length {
+		return e.Field + " must be " + r + " characters or items long"
+	}
+	return e.Field + " must be " + r
+}
+
+// InvalidFormat is an error type that can be used when validating
+// input fields whose value is not in the expected format. Want
+// describes the expected format, e.g. "a valid email address"
+type InvalidFormat struct {
+	Field string
+	Want  string
+}
+
+func (e InvalidFormat) Error() string {
+	return e.Field + " must be " + e.Want
+}
+
+// FieldError describes a problem with one input field. Err is the
+// underlying error, if any, e.g. a MissingField
+type FieldError struct {
+	Param   Parameter
+	Code    Code
+	Message string
+	Err     error
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// Unwrap method allows for unwrapping errors using errors.As
+func (e FieldError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler
+func (e FieldError) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("Parameter", string(e.Param)).
+		Str("Code", string(e.Code)).
+		Str("Message", e.Message)
+}
+
+// ValidationErrors collects the problems found when validating
+// several input fields, so they can all be reported at once. Pass it
+// to E (the Kind defaults to Validation) and HTTPErrorResponse sends
+// each FieldError in the errors array of the response body. Use
+// errors.As to get the ValidationErrors back from an error.
+//
+//	var verrs errs.ValidationErrors
+//	if u.Email == "" {
+//		verrs.Add("email", "required", errs.MissingField("email").Error())
+//	}
+//	if err := verrs.Err(); err != nil {
+//		return errs.E(err)
+//	}
+type ValidationErrors []FieldError
+
+// Add appends a FieldError for param
+func (v *ValidationErrors) Add(param Parameter, code Code, message string) {
+	*v = append(*v, FieldError{Param: param, Code: code, Message: message})
+}
+
+// Err returns v as an error, or nil if no errors have been added
+func (v ValidationErrors) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// As allows errors.As to find an error type held by any of the
+// field errors, e.g. errors.As(err, &missingField)
+func (v ValidationErrors) As(target interface{}) bool {
+	for _, fe := range v {
+		if fe.Err != nil && errors.As(fe.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, fe := range v {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -1,9 +1,14 @@
 package errs
 
 import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
 func TestMissingField(t *testing.T) {
@@ -85,3 +90,43 @@ func TestInputUnwanted_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestValidationErrors(t *testing.T) {
+	var verrs ValidationErrors
+	if verrs.Err() != nil {
+		t.Fatal("Err() of empty ValidationErrors is not nil")
+	}
+	verrs.Add("email", "required", MissingField("email").Error())
+	verrs.Add("age", "out_of_range", "age must be between 0 and 150")
+
+	err := E(verrs.Err())
+
+	e, ok := err.(*Error)
+	if !ok || e.Kind != Validation {
+		t.Fatalf("E(ValidationErrors) = %#v, want Kind Validation", err)
+	}
+
+	var got ValidationErrors
+	if !errors.As(err, &got) || len(got) != 2 {
+		t.Fatalf("errors.As() = %v, want 2 field errors", got)
+	}
+	if want := "email is required; age must be between 0 and 150"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	var b bytes.Buffer
+	w := httptest.NewRecorder()
+	HTTPErrorResponse(w, zerolog.New(&b), err)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("StatusCode = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	wantBody := `{"error":{"kind":"input_validation_error","message":"email is required; age must be between 0 and 150","errors":[{"param":"email","code":"required","message":"email is required"},{"param":"age","code":"out_of_range","message":"age must be between 0 and 150"}]}}`
+	if got := strings.TrimSpace(w.Body.String()); got != wantBody {
+		t.Errorf("body = %s, want %s", got, wantBody)
+	}
+	wantLog := `"Errors":[{"Parameter":"email","Code":"required","Message":"email is required"},{"Parameter":"age","Code":"out_of_range","Message":"age must be between 0 and 150"}]`
+	if !strings.Contains(b.String(), wantLog) {
+		t.Errorf("log = %s, want it to contain %s", b.String(), wantLog)
+	}
+}
@@ -0,0 +1,104 @@
+package httplog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+// field is a key/value pair added to the request by a handler
+type field struct {
+	key   string
+	value interface{}
+}
+
+// reservedFields are written by httplog in the "Response Sent" event
+// and cannot be set with AddField
+var reservedFields = map[string]bool{
+	"level":           true,
+	"time":            true,
+	"message":         true,
+	"request_id":      true,
+	"trace_id":        true,
+	"span_id":         true,
+	"client_id":       true,
+	"user":            true,
+	"response_code":   true,
+	"response_header": true,
+	"response_body":   true,
+	"phases":          true,
+	"latency":         true,
+	"ua_name":         true,
+	"ua_version":      true,
+	"ua_os":           true,
+	"ua_os_version":   true,
+	"ua_device":       true,
+	"ua_bot":          true,
+}
+
+// AddField attaches a custom field, such as a business identifier
+// (order_id, tenant, a feature flag), to the request's audit record.
+// Fields are written as top-level fields of the "Response Sent" event
+// and stored as a JSON object in the attributes column of the audit
+// table. Adding a key again replaces its value. Keys used by httplog
+// itself (request_id, user, response_code, etc.) are ignored. value
+// should be marshalable to JSON; if it is not, its fmt.Sprint form is
+// stored instead. AddField is safe to call from multiple
+// goroutines. If ctx did not come through the middleware, the field
+// is not recorded.
+func AddField(ctx context.Context, key string, value interface{}) {
+	s := stateFromContext(ctx)
+	if s == nil || key == "" || reservedFields[key] {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.fields {
+		if s.fields[i].key == key {
+			s.fields[i].value = value
+			return
+		}
+	}
+	s.fields = append(s.fields, field{key: key, value: value})
+}
+
+// Fields returns a copy of the fields added with AddField, in the
+// order they were first added
+func (s *requestState) Fields() []field {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]field(nil), s.fields...)
+}
+
+// fieldsJSON returns the fields as a JSON object, or an empty string
+// if there are none. Each value is marshaled on its own; a value that
+// fails is logged and stored as its fmt.Sprint form, so the other
+// fields are still recorded
+func fieldsJSON(log zerolog.Logger, fields []field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	m := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		b, err := json.Marshal(f.value)
+		if err != nil {
+			log.Error().Err(err).Str("field", f.key).Msg("field stored as text")
+			b, _ = json.Marshal(fmt.Sprint(f.value))
+		}
+		m[f.key] = b
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		log.Error().Err(err).Msg("fields not stored")
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,81 @@
+package httplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestAddField(t *testing.T) {
+	ctx, aud := newTestRequestContext(t, nil, zerolog.Nop())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			AddField(ctx, fmt.Sprintf("key%d", i), i)
+		}(i)
+	}
+	wg.Wait()
+
+	AddField(ctx, "order_id", "A1")
+	AddField(ctx, "order_id", "A2")
+	AddField(ctx, "request_id", "spoofed")
+
+	fields := aud.state.Fields()
+	if len(fields) != 11 {
+		t.Fatalf("Fields() returned %d fields, want 11", len(fields))
+	}
+	if f := fields[10]; f.key != "order_id" || f.value != "A2" {
+		t.Errorf("order_id field = %+v, want A2", f)
+	}
+
+	var buf bytes.Buffer
+	logResp2Stdout(zerolog.New(&buf).Level(zerolog.InfoLevel), aud, ROpt{})
+
+	var ev map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &ev); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if ev["order_id"] != "A2" || ev["key3"] != float64(3) {
+		t.Errorf("Response Sent event = %v, want order_id and key3 fields", ev)
+	}
+	if ev["request_id"] != aud.requestID {
+		t.Errorf("request_id = %v, want %s", ev["request_id"], aud.requestID)
+	}
+
+	var attrs map[string]interface{}
+	if err := json.Unmarshal([]byte(newDBRecord(zerolog.Nop(), aud, new(Opts)).Attributes), &attrs); err != nil {
+		t.Fatalf("dbRecord Attributes is not valid JSON: %v", err)
+	}
+	if attrs["order_id"] != "A2" || len(attrs) != 11 {
+		t.Errorf("dbRecord Attributes = %v", attrs)
+	}
+}
+
+func Test_fieldsJSON_BadValue(t *testing.T) {
+	var buf bytes.Buffer
+	fields := []field{
+		{key: "order_id", value: "A1"},
+		{key: "callback", value: func() {}},
+	}
+
+	var attrs map[string]interface{}
+	if err := json.Unmarshal([]byte(fieldsJSON(zerolog.New(&buf), fields)), &attrs); err != nil {
+		t.Fatalf("fieldsJSON() is not valid JSON: %v", err)
+	}
+	if attrs["order_id"] != "A1" {
+		t.Errorf("order_id = %v, want A1", attrs["order_id"])
+	}
+	if _, ok := attrs["callback"].(string); !ok {
+		t.Errorf("callback = %v, want its fmt.Sprint form", attrs["callback"])
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"field":"callback"`)) {
+		t.Errorf("marshal failure was not logged, log = %s", buf.String())
+	}
+}
@@ -0,0 +1,357 @@
+package httplog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// rotateTimeFormat is the time layout used as the suffix for rotated
+// files. It sorts lexically in time order and is safe for file names
+const rotateTimeFormat = "20060102T150405.000"
+
+// fileSinks holds the open log files, keyed by path, so that each
+// file is opened once no matter how many middleware instances use it
+var (
+	fileSinksMu sync.Mutex
+	fileSinks   = make(map[string]*rotatingFile)
+	sighupOnce  sync.Once
+)
+
+// fileLogger returns a zerolog.Logger which writes to the rotating
+// file described by fo
+func fileLogger(fo FileOpt) (zerolog.Logger, error) {
+	rf, err := openFileSink(fo)
+	if err != nil {
+		return zerolog.Nop(), err
+	}
+	return rf.logger, nil
+}
+
+// openFileSink returns the rotating file described by fo. The file
+// is opened on first use and a SIGHUP handler is registered to reopen
+// all open files
+func openFileSink(fo FileOpt) (*rotatingFile, error) {
+	if fo.Path == "" {
+		return nil, errors.New("log file path is empty")
+	}
+
+	fileSinksMu.Lock()
+	defer fileSinksMu.Unlock()
+
+	rf, ok := fileSinks[fo.Path]
+	if !ok {
+		var err error
+		rf, err = newRotatingFile(fo.Path,
+			int64(fo.MaxSizeMB)*1024*1024,
+			time.Duration(fo.RotateMinutes)*time.Minute,
+			fo.MaxFiles,
+			fo.Compress)
+		if err != nil {
+			return nil, err
+		}
+		fileSinks[fo.Path] = rf
+	}
+
+	sighupOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		go func() {
+			for range c {
+				ReopenLogFiles()
+			}
+		}()
+	})
+
+	return rf, nil
+}
+
+// ReopenLogFiles closes and reopens every log file opened by the
+// Log2File or Log2HAR options. It is called automatically when the
+// process receives SIGHUP, which allows external tools such as
+// logrotate to move the files out of the way.
+func ReopenLogFiles() error {
+	fileSinksMu.Lock()
+	defer fileSinksMu.Unlock()
+
+	var rerr error
+	for _, rf := range fileSinks {
+		if err := rf.reopen(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	return rerr
+}
+
+// rotatingFile is an io.Writer which writes to a file and rotates it
+// once it reaches maxSize bytes or has been open longer than
+// interval. A zero maxSize or interval disables that trigger.
+// Rotated files are renamed with a timestamp suffix, optionally
+// gzip compressed, and at most maxFiles are kept (0 keeps all)
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+	maxFiles int
+	compress bool
+	logger   zerolog.Logger
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// bg tracks compression and cleanup of rotated files
+	bg   sync.WaitGroup
+	bgMu sync.Mutex
+}
+
+func newRotatingFile(path string, maxSize int64, interval time.Duration, maxFiles int, compress bool) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:     path,
+		maxSize:  maxSize,
+		interval: interval,
+		maxFiles: maxFiles,
+		compress: compress,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	rf.logger = zerolog.New(rf).Level(zerolog.InfoLevel).With().Timestamp().Logger()
+	return rf, nil
+}
+
+// open opens (or creates) the file at path for appending
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = fi.Size()
+	rf.openedAt = time.Now()
+	return nil
+}
+
+// Write satisfies the io.Writer interface. The file is rotated
+// before the write if the write would push it past maxSize or the
+// rotation interval has elapsed
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if rf.size > 0 && rf.shouldRotate(int64(len(p))) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) shouldRotate(n int64) bool {
+	if rf.maxSize > 0 && rf.size+n > rf.maxSize {
+		return true
+	}
+	if rf.interval > 0 && time.Since(rf.openedAt) >= rf.interval {
+		return true
+	}
+	return false
+}
+
+// rotate closes the current file, renames it with a timestamp suffix
+// and opens a new file at path. Compression and removal of old files
+// happen in the background. rf.mu must be held
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+
+	rotated := rf.path + "." + time.Now().UTC().Format(rotateTimeFormat)
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = rf.path + "." + time.Now().UTC().Format(rotateTimeFormat) + "-" + strconv.Itoa(i)
+	}
+	if err := os.Rename(rf.path, rotated); err != nil {
+		return err
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.bg.Add(1)
+	go func() {
+		defer rf.bg.Done()
+		rf.bgMu.Lock()
+		defer rf.bgMu.Unlock()
+		if rf.compress {
+			gzipFile(rotated)
+		}
+		rf.removeOld()
+	}()
+
+	return nil
+}
+
+// reopen closes and reopens the file at path
+func (rf *rotatingFile) reopen() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file != nil {
+		if err := rf.file.Close(); err != nil {
+			return err
+		}
+		rf.file = nil
+	}
+	return rf.open()
+}
+
+// wait blocks until background compression and cleanup is done
+func (rf *rotatingFile) wait() {
+	rf.bg.Wait()
+}
+
+// removeOld removes the oldest rotated files so that at most
+// maxFiles are kept
+func (rf *rotatingFile) removeOld() {
+	if rf.maxFiles <= 0 {
+		return
+	}
+	rotated := rf.rotatedFiles()
+	if len(rotated) <= rf.maxFiles {
+		return
+	}
+	for _, name := range rotated[:len(rotated)-rf.maxFiles] {
+		os.Remove(name)
+	}
+}
+
+// rotatedFiles returns the rotated files for path, oldest first.
+// Only files named path + "." + a rotateTimeFormat timestamp, with an
+// optional "-N" counter and ".gz" extension, are included, so other
+// files sharing the path as a prefix (access.log.bak, a HAR file at
+// access.log.har, etc.) are never removed
+func (rf *rotatingFile) rotatedFiles() []string {
+	dir, base := filepath.Split(rf.path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	type rotatedFile struct {
+		name string
+		at   time.Time
+		n    int
+	}
+	var rotated []rotatedFile
+	for _, e := range entries {
+		at, n, ok := parseRotatedName(base, e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		rotated = append(rotated, rotatedFile{name: filepath.Join(dir, e.Name()), at: at, n: n})
+	}
+	// compressed and uncompressed files sort together by timestamp
+	sort.Slice(rotated, func(i, j int) bool {
+		if !rotated[i].at.Equal(rotated[j].at) {
+			return rotated[i].at.Before(rotated[j].at)
+		}
+		return rotated[i].n < rotated[j].n
+	})
+
+	names := make([]string, len(rotated))
+	for i, r := range rotated {
+		names[i] = r.name
+	}
+	return names
+}
+
+// parseRotatedName reports whether name is a file rotated from base,
+// returning the rotation time and counter (0 if there is none)
+func parseRotatedName(base, name string) (at time.Time, n int, ok bool) {
+	suffix := strings.TrimPrefix(name, base+".")
+	if suffix == name {
+		return at, 0, false
+	}
+	suffix = strings.TrimSuffix(suffix, ".gz")
+	if i := strings.LastIndexByte(suffix, '-'); i >= 0 {
+		var err error
+		n, err = strconv.Atoi(suffix[i+1:])
+		if err != nil || n < 1 {
+			return at, 0, false
+		}
+		suffix = suffix[:i]
+	}
+	at, err := time.Parse(rotateTimeFormat, suffix)
+	if err != nil {
+		return at, 0, false
+	}
+	return at, n, true
+}
+
+// gzipFile compresses name to name.gz and removes name
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := name + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,141 @@
+package httplog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_rotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.log")
+
+	// rotate after 10 bytes, keep 2 rotated files, compressed
+	rf, err := newRotatingFile(path, 10, 0, 2, true)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+
+	for _, line := range []string{"line-0001\n", "line-0002\n", "line-0003\n", "line-0004\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		rf.wait()
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if got := string(b); got != "line-0004\n" {
+		t.Errorf("current file = %q, want %q", got, "line-0004\n")
+	}
+
+	rotated := rf.rotatedFiles()
+	if len(rotated) != 2 {
+		t.Fatalf("rotated files = %v, want 2 files", rotated)
+	}
+	for i, want := range []string{"line-0002\n", "line-0003\n"} {
+		if !strings.HasSuffix(rotated[i], ".gz") {
+			t.Errorf("rotated file %s is not compressed", rotated[i])
+			continue
+		}
+		f, err := os.Open(rotated[i])
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader() error = %v", err)
+		}
+		got, _ := io.ReadAll(zr)
+		f.Close()
+		if string(got) != want {
+			t.Errorf("rotated file %s = %q, want %q", rotated[i], got, want)
+		}
+	}
+}
+
+func Test_rotatingFile_reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.log")
+
+	rf, err := newRotatingFile(path, 0, 0, 0, false)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	rf.Write([]byte("before\n"))
+
+	// simulate an external tool moving the file away
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rf.reopen(); err != nil {
+		t.Fatalf("reopen() error = %v", err)
+	}
+	rf.Write([]byte("after\n"))
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if got := string(b); got != "after\n" {
+		t.Errorf("reopened file = %q, want %q", got, "after\n")
+	}
+}
+
+func Test_rotatingFile_keepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	others := []string{"access.log.bak", "access.log.1", "access.log.har", "access.log.20060102T150405.000.tmp"}
+	for _, name := range others {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("keep"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// rotate after 10 bytes, keep 1 rotated file
+	rf, err := newRotatingFile(path, 10, 0, 1, false)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	for _, line := range []string{"line-0001\n", "line-0002\n", "line-0003\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		rf.wait()
+	}
+
+	if rotated := rf.rotatedFiles(); len(rotated) != 1 {
+		t.Errorf("rotated files = %v, want 1 file", rotated)
+	}
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+}
+
+func Test_parseRotatedName(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		ok   bool
+	}{
+		{"access.log.20211001T140237.123", 0, true},
+		{"access.log.20211001T140237.123-2.gz", 2, true},
+		{"access.log.20211001T140237.123.gz", 0, true},
+		{"access.log.har", 0, false},
+		{"access.log.1", 0, false},
+		{"access.log.20211001T140237.123-x", 0, false},
+		{"other.log.20211001T140237.123", 0, false},
+	}
+	for _, tt := range tests {
+		_, n, ok := parseRotatedName("access.log", tt.name)
+		if ok != tt.ok || n != tt.n {
+			t.Errorf("parseRotatedName(%q) = %d, %v, want %d, %v", tt.name, n, ok, tt.n, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package httplog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// harVersion is the version of the HAR specification written
+const harVersion = "1.2"
+
+// HAR is an HTTP Archive document, as described by the HAR 1.2
+// specification (http://www.softwareishard.com/blog/har-12-spec/).
+// HAR files can be imported by browser developer tools and most
+// HTTP debugging proxies.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of the exported data
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator names the application which created the log
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one captured request/response exchange. RequestID is
+// a custom field (custom fields start with an underscore per the
+// spec) holding the httplog unique request id
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	RequestID       string      `json:"_requestId,omitempty"`
+}
+
+// HARRequest holds the details of the request
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse holds the details of the response
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a name/value pair used for headers and
+// query string parameters
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARCookie holds a request or response cookie
+type HARCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HTTPOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+
+// HARPostData holds the request body
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent holds the response body
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// HARTimings holds the timings of the exchange in milliseconds, as
+// seen by the server. Send is the time spent reading the request
+// body, Wait the time from then until the handler first wrote to
+// the response and Receive the time from then until the response
+// had been written. The phases that are not measured are set to -1
+// as required by the spec
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// NewHAR returns a HAR document holding the given entries
+func NewHAR(entries []HAREntry) HAR {
+	if entries == nil {
+		entries = []HAREntry{}
+	}
+	return HAR{
+		Log: HARLog{
+			Version: harVersion,
+			Creator: HARCreator{Name: "github.com/gilcrest/httplog"},
+			Entries: entries,
+		},
+	}
+}
+
+// ReadHAR reads HAR entries written by the Log2HAR option (one JSON
+// entry per line) from r and returns them as a HAR document
+func ReadHAR(r io.Reader) (HAR, error) {
+	var entries []HAREntry
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e HAREntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return HAR{}, err
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return HAR{}, err
+	}
+
+	return NewHAR(entries), nil
+}
+
+// logReqResp2HAR writes a HAR entry for the exchange as a single
+// line of JSON to the Log2HAR file
+func logReqResp2HAR(log zerolog.Logger, t *tracker, o Log2HAR) error {
+	rf, err := openFileSink(o.File)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(newHAREntry(log, t, o))
+	if err != nil {
+		return err
+	}
+
+	_, err = rf.Write(append(b, '\n'))
+	return err
+}
+
+// newHAREntry builds a HAREntry from the tracker. Headers and body
+// are only included if enabled in the Log2HAR options. A header
+// that cannot be parsed is logged and left out of the entry
+func newHAREntry(log zerolog.Logger, t *tracker, o Log2HAR) HAREntry {
+	reqHdr, err := parseHeader(t.request.header)
+	if err != nil {
+		log.Error().Err(err).Msg("HAR entry request headers omitted")
+	}
+	respHdr, err := parseHeader(t.response.header)
+	if err != nil {
+		log.Error().Err(err).Msg("HAR entry response headers omitted")
+	}
+
+	u := url.URL{
+		Scheme:   t.request.scheme,
+		Host:     t.request.host,
+		Path:     t.request.path,
+		RawQuery: t.request.rawQuery,
+	}
+	if t.request.port != "" {
+		u.Host = net.JoinHostPort(t.request.host, t.request.port)
+	}
+
+	ms := float64(t.duration) / float64(time.Millisecond)
+
+	e := HAREntry{
+		StartedDateTime: t.timeStarted,
+		Time:            ms,
+		Request: HARRequest{
+			Method:      t.request.method,
+			URL:         u.String(),
+			HTTPVersion: t.request.proto,
+			Cookies:     []HARCookie{},
+			Headers:     []HARNameValue{},
+			QueryString: harQueryString(t.request.rawQuery),
+			HeadersSize: -1,
+			BodySize:    t.request.contentLength,
+		},
+		Response: HARResponse{
+			Status:      t.responseCode,
+			StatusText:  http.StatusText(t.responseCode),
+			HTTPVersion: t.request.proto,
+			Cookies:     []HARCookie{},
+			Headers:     []HARNameValue{},
+			Content: HARContent{
+				Size:     int64(len(t.response.body)),
+				MimeType: respHdr.Get("Content-Type"),
+			},
+			RedirectURL: respHdr.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    int64(len(t.response.body)),
+		},
+		Timings: HARTimings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			Send:    0,
+			Wait:    ms,
+			Receive: 0,
+			SSL:     -1,
+		},
+		RequestID: t.requestID,
+	}
+
+	// trackers from the middleware have the latency breakdown,
+	// otherwise the whole duration is recorded as Wait
+	if l := t.latency; l.firstByte > 0 {
+		e.Timings.Send = millis(l.bodyRead)
+		e.Timings.Wait = millis(l.firstByte - l.bodyRead)
+		e.Timings.Receive = millis(t.duration - l.firstByte)
+	}
+
+	if o.Request.Header {
+		e.Request.Headers = harHeaders(reqHdr)
+		e.Request.Cookies = harRequestCookies(reqHdr)
+	}
+	if o.Request.Body && t.request.body != "" {
+		e.Request.PostData = &HARPostData{
+			MimeType: reqHdr.Get("Content-Type"),
+			Text:     t.request.body,
+		}
+	}
+	if o.Response.Header {
+		e.Response.Headers = harHeaders(respHdr)
+		e.Response.Cookies = harResponseCookies(respHdr)
+	}
+	if o.Response.Body {
+		e.Response.Content.Text = t.response.body
+	}
+
+	return e
+}
+
+// parseHeader converts the JSON string representation of a header
+// held by the tracker back to an http.Header. If s cannot be parsed
+// an empty header is returned along with the error
+func parseHeader(s string) (http.Header, error) {
+	h := make(http.Header)
+	if s == "" {
+		return h, nil
+	}
+	if err := json.Unmarshal([]byte(s), &h); err != nil {
+		return make(http.Header), errors.Wrap(err, "invalid header JSON")
+	}
+	return h, nil
+}
+
+// harHeaders converts an http.Header to HAR name/value pairs,
+// sorted by header name so the output is stable
+func harHeaders(h http.Header) []HARNameValue {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	nv := []HARNameValue{}
+	for _, k := range keys {
+		for _, v := range h[k] {
+			nv = append(nv, HARNameValue{Name: k, Value: v})
+		}
+	}
+	return nv
+}
+
+// harQueryString splits a raw query into HAR name/value pairs,
+// keeping the order in which they appear
+func harQueryString(rawQuery string) []HARNameValue {
+	nv := []HARNameValue{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		k, v := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			k, v = pair[:i], pair[i+1:]
+		}
+		if uk, err := url.QueryUnescape(k); err == nil {
+			k = uk
+		}
+		if uv, err := url.QueryUnescape(v); err == nil {
+			v = uv
+		}
+		nv = append(nv, HARNameValue{Name: k, Value: v})
+	}
+	return nv
+}
+
+func harRequestCookies(h http.Header) []HARCookie {
+	req := http.Request{Header: h}
+	hc := []HARCookie{}
+	for _, c := range req.Cookies() {
+		hc = append(hc, HARCookie{Name: c.Name, Value: c.Value})
+	}
+	return hc
+}
+
+func harResponseCookies(h http.Header) []HARCookie {
+	resp := http.Response{Header: h}
+	hc := []HARCookie{}
+	for _, c := range resp.Cookies() {
+		cookie := HARCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			exp := c.Expires
+			cookie.Expires = &exp
+		}
+		hc = append(hc, cookie)
+	}
+	return hc
+}
@@ -0,0 +1,118 @@
+package httplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func Test_newHAREntry(t *testing.T) {
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	trk := &tracker{
+		requestID:    "c0ffee",
+		timeStarted:  started,
+		timeFinished: started.Add(1500 * time.Microsecond),
+		duration:     1500 * time.Microsecond,
+		responseCode: 201,
+	}
+	trk.request.method = "POST"
+	trk.request.scheme = "http"
+	trk.request.host = "127.0.0.1"
+	trk.request.port = "8080"
+	trk.request.path = "/api/v1/user"
+	trk.request.rawQuery = "a=1&b=two%20words"
+	trk.request.proto = "HTTP/1.1"
+	trk.request.header = `{"Content-Type":["application/json"],"Cookie":["session=abc"]}`
+	trk.request.body = `{"name":"otto"}`
+	trk.request.contentLength = 15
+	trk.response.header = `{"Content-Type":["application/json"]}`
+	trk.response.body = `{"id":1}`
+
+	o := Log2HAR{
+		Enable:   true,
+		Request:  ROpt{Header: true, Body: true},
+		Response: ROpt{Header: true, Body: true},
+	}
+
+	e := newHAREntry(zerolog.Nop(), trk, o)
+
+	if e.Request.URL != "http://127.0.0.1:8080/api/v1/user?a=1&b=two%20words" {
+		t.Errorf("Request.URL = %s", e.Request.URL)
+	}
+	if len(e.Request.QueryString) != 2 || e.Request.QueryString[1].Value != "two words" {
+		t.Errorf("Request.QueryString = %v", e.Request.QueryString)
+	}
+	if e.Request.PostData == nil || e.Request.PostData.MimeType != "application/json" || e.Request.PostData.Text != trk.request.body {
+		t.Errorf("Request.PostData = %v", e.Request.PostData)
+	}
+	if len(e.Request.Cookies) != 1 || e.Request.Cookies[0].Name != "session" {
+		t.Errorf("Request.Cookies = %v", e.Request.Cookies)
+	}
+	if e.Response.Status != 201 || e.Response.StatusText != "Created" {
+		t.Errorf("Response status = %d %s", e.Response.Status, e.Response.StatusText)
+	}
+	if e.Response.Content.Text != `{"id":1}` || e.Response.Content.MimeType != "application/json" {
+		t.Errorf("Response.Content = %v", e.Response.Content)
+	}
+	if e.Time != 1.5 || e.Timings.Wait != 1.5 {
+		t.Errorf("Time = %v, Timings.Wait = %v, want 1.5", e.Time, e.Timings.Wait)
+	}
+	if !e.StartedDateTime.Equal(started) {
+		t.Errorf("StartedDateTime = %v, want %v", e.StartedDateTime, started)
+	}
+
+	// body and headers are left out when not enabled
+	e = newHAREntry(zerolog.Nop(), trk, Log2HAR{Enable: true})
+	if e.Request.PostData != nil || len(e.Request.Headers) != 0 || e.Response.Content.Text != "" {
+		t.Errorf("newHAREntry() included headers or body when not enabled: %+v", e)
+	}
+}
+
+func Test_newHAREntry_IPv6AndBadHeader(t *testing.T) {
+	trk := &tracker{responseCode: 200}
+	trk.request.scheme = "http"
+	trk.request.host = "::1"
+	trk.request.port = "8080"
+	trk.request.path = "/"
+	trk.request.header = `{"Content-Type":`
+
+	var buf bytes.Buffer
+	e := newHAREntry(zerolog.New(&buf), trk, Log2HAR{Request: ROpt{Header: true}})
+
+	if e.Request.URL != "http://[::1]:8080/" {
+		t.Errorf("Request.URL = %s, want http://[::1]:8080/", e.Request.URL)
+	}
+	if len(e.Request.Headers) != 0 {
+		t.Errorf("Request.Headers = %v, want none", e.Request.Headers)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("request headers omitted")) {
+		t.Errorf("header parse error was not logged, log = %s", buf.String())
+	}
+}
+
+func TestReadHAR(t *testing.T) {
+	var buf bytes.Buffer
+	for _, id := range []string{"one", "two"} {
+		b, err := json.Marshal(HAREntry{RequestID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	har, err := ReadHAR(&buf)
+	if err != nil {
+		t.Fatalf("ReadHAR() error = %v", err)
+	}
+	if har.Log.Version != "1.2" {
+		t.Errorf("Log.Version = %s, want 1.2", har.Log.Version)
+	}
+	if len(har.Log.Entries) != 2 || har.Log.Entries[1].RequestID != "two" {
+		t.Errorf("Log.Entries = %v", har.Log.Entries)
+	}
+}
@@ -0,0 +1,38 @@
+package httplog
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/httplog/errs"
+)
+
+// RequestIDHeader is the response header the middleware sets to the
+// unique request id when Opts.ResponseHeaders.RequestID is true. It
+// is the same header errs sets in error responses
+const RequestIDHeader = errs.RequestIDHeader
+
+// setResponseHeaders sets the headers turned on in
+// opts.ResponseHeaders. The middleware calls it once the handler
+// has returned, just before the response is written
+func setResponseHeaders(h http.Header, t *tracker, opts *Opts) {
+	if opts.ResponseHeaders.RequestID {
+		h.Set(RequestIDHeader, t.requestID)
+	}
+	if opts.ResponseHeaders.ServerTiming {
+		var metrics []string
+		for _, p := range t.state.Phases() {
+			metrics = append(metrics, serverTimingMetric(serverTimingName(p.name), p.dur))
+		}
+		metrics = append(metrics, serverTimingMetric("total", time.Since(t.latency.received)))
+		h.Add("Server-Timing", strings.Join(metrics, ", "))
+	}
+}
+
+// serverTimingMetric formats a Server-Timing metric, the duration
+// is sent in milliseconds
+func serverTimingMetric(name string, d time.Duration) string {
+	return name + ";dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
@@ -0,0 +1,85 @@
+package httplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/gilcrest/httplog/errs"
+)
+
+func TestLogHandler_ResponseHeaders(t *testing.T) {
+	opts := new(Opts)
+	opts.Option(SetResponseHeaders(true, true))
+
+	var requestID string
+	h := LogHandler(zerolog.Nop(), nil, opts)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestID, _ = RequestID(req.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com:8080/", nil))
+
+	if got := w.Header().Get(RequestIDHeader); got == "" || got != requestID {
+		t.Errorf("%s = %q, want %q", RequestIDHeader, got, requestID)
+	}
+	if got := w.Header().Get("Server-Timing"); !strings.HasPrefix(got, "total;dur=") {
+		t.Errorf("Server-Timing = %q, want total;dur=...", got)
+	}
+}
+
+func TestLogHandler_NoResponseHeaders(t *testing.T) {
+	h := LogHandler(zerolog.Nop(), nil, new(Opts))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com:8080/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	for _, k := range []string{RequestIDHeader, "Server-Timing"} {
+		if got := w.Header().Get(k); got != "" {
+			t.Errorf("%s = %q, want none", k, got)
+		}
+	}
+}
+
+func TestLogHandler_ErrorResponseRequestID(t *testing.T) {
+	var b bytes.Buffer
+	lgr := zerolog.New(&b)
+
+	h := LogHandler(lgr, nil, new(Opts))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		errs.HTTPErrorResponseRequest(w, req, errs.E(errs.NotExist, "user not found"))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com:8080/user/1", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" {
+		t.Fatalf("%s not set", RequestIDHeader)
+	}
+
+	var er errs.ErrResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &er); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if er.Error.RequestID != id {
+		t.Errorf("RequestID = %q, want %q", er.Error.RequestID, id)
+	}
+
+	for _, want := range []string{`"request_id":"` + id + `"`, `"method":"GET"`, `"path":"/user/1"`, `"message":"Error Response Sent"`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("error log = %s, want it to contain %s", b.String(), want)
+		}
+	}
+}
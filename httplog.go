@@ -39,6 +39,7 @@ import (
 // LogHandlerFunc middleware records and logs as much as possible about an
 // incoming HTTP request and response
 func LogHandlerFunc(next http.HandlerFunc, logger zerolog.Logger, db *sql.DB, o *Opts) http.HandlerFunc {
+	trusted := trustedProxies(o)
 	return func(w http.ResponseWriter, req *http.Request) {
 
 		var (
@@ -65,17 +66,15 @@ func LogHandlerFunc(next http.HandlerFunc, logger zerolog.Logger, db *sql.DB, o
 		// Pull the context from the request
 		ctx := req.Context()
 
-		// Create an instance of APIaudit and pass it to startTimer
-		// to begin the API response timer
-		ctx, aud, err := newAPIAudit(ctx, logger, req)
+		// Create an instance of APIaudit, which also starts
+		// the API response timer
+		ctx, aud, err := newAPIAudit(ctx, logger, req, opts, trusted)
 		if err != nil {
 			errs.HTTPErrorResponse(w, logger, errs.E(errs.Internal, "Unable to log request"))
 			return
 		}
 
-		aud.startTimer()
-
-		ctx = setRequest2Context(ctx, aud)
+		ctx = setRequest2Context(ctx, logger, aud)
 
 		// RequestLogController determines which of the logging methods
 		// you wish to use will be employed (based on the options passed in)
@@ -86,13 +85,15 @@ func LogHandlerFunc(next http.HandlerFunc, logger zerolog.Logger, db *sql.DB, o
 		}
 
 		rec := httptest.NewRecorder()
-		next.ServeHTTP(rec, req.WithContext(ctx))
+		next.ServeHTTP(newFirstByteWriter(rec, aud), req.WithContext(ctx))
+		aud.markHandled()
 
 		// copy everything from response recorder
 		// to actual response writer
 		for k, v := range rec.Header() {
 			w.Header()[k] = v
 		}
+		setResponseHeaders(w.Header(), aud, opts)
 		w.WriteHeader(rec.Code)
 
 		// pull out the response body and write it
@@ -123,6 +124,7 @@ func LogHandlerFunc(next http.HandlerFunc, logger zerolog.Logger, db *sql.DB, o
 // LogHandler records and logs as much as possible about an
 // incoming HTTP request and response
 func LogHandler(logger zerolog.Logger, db *sql.DB, o *Opts) (mw func(http.Handler) http.Handler) {
+	trusted := trustedProxies(o)
 	mw = func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 
@@ -150,17 +152,15 @@ func LogHandler(logger zerolog.Logger, db *sql.DB, o *Opts) (mw func(http.Handle
 			// Pull the context from the request
 			ctx := req.Context()
 
-			// Create an instance of APIaudit and pass it to startTimer
-			// to begin the API response timer
-			ctx, aud, err := newAPIAudit(ctx, logger, req)
+			// Create an instance of APIaudit, which also starts
+			// the API response timer
+			ctx, aud, err := newAPIAudit(ctx, logger, req, opts, trusted)
 			if err != nil {
 				errs.HTTPErrorResponse(w, logger, errs.E(errs.Internal, "Unable to log request"))
 				return
 			}
 
-			aud.startTimer()
-
-			ctx = setRequest2Context(ctx, aud)
+			ctx = setRequest2Context(ctx, logger, aud)
 
 			// RequestLogController determines which of the logging methods
 			// you wish to use will be employed (based on the options passed in)
@@ -171,13 +171,15 @@ func LogHandler(logger zerolog.Logger, db *sql.DB, o *Opts) (mw func(http.Handle
 			}
 
 			rec := httptest.NewRecorder()
-			h.ServeHTTP(rec, req.WithContext(ctx))
+			h.ServeHTTP(newFirstByteWriter(rec, aud), req.WithContext(ctx))
+			aud.markHandled()
 
 			// copy everything from response recorder
 			// to actual response writer
 			for k, v := range rec.Header() {
 				w.Header()[k] = v
 			}
+			setResponseHeaders(w.Header(), aud, opts)
 			w.WriteHeader(rec.Code)
 
 			// pull out the response body and write it
@@ -211,6 +213,7 @@ func LogHandler(logger zerolog.Logger, db *sql.DB, o *Opts) (mw func(http.Handle
 // incoming HTTP request and response using the Adapter pattern
 // Found adapter pattern in a Mat Ryer post
 func LogAdapter(logger zerolog.Logger, db *sql.DB, o *Opts) Adapter {
+	trusted := trustedProxies(o)
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 
@@ -238,16 +241,15 @@ func LogAdapter(logger zerolog.Logger, db *sql.DB, o *Opts) Adapter {
 			// Pull the context from the request
 			ctx := req.Context()
 
-			// Create an instance of APIaudit and pass it to startTimer
-			// to begin the API response timer
-			ctx, aud, err := newAPIAudit(ctx, logger, req)
+			// Create an instance of APIaudit, which also starts
+			// the API response timer
+			ctx, aud, err := newAPIAudit(ctx, logger, req, opts, trusted)
 			if err != nil {
 				errs.HTTPErrorResponse(w, logger, errs.E(errs.Internal, "Unable to log request"))
 				return
 			}
-			aud.startTimer()
 
-			ctx = setRequest2Context(ctx, aud)
+			ctx = setRequest2Context(ctx, logger, aud)
 
 			// RequestLogController determines which of the logging methods
 			// you wish to use will be employed (based on the options passed in)
@@ -259,13 +261,15 @@ func LogAdapter(logger zerolog.Logger, db *sql.DB, o *Opts) Adapter {
 			}
 
 			rec := httptest.NewRecorder()
-			h.ServeHTTP(rec, req.WithContext(ctx))
+			h.ServeHTTP(newFirstByteWriter(rec, aud), req.WithContext(ctx))
+			aud.markHandled()
 
 			// copy everything from response recorder
 			// to actual response writer
 			for k, v := range rec.Header() {
 				w.Header()[k] = v
 			}
+			setResponseHeaders(w.Header(), aud, opts)
 			w.WriteHeader(rec.Code)
 
 			// pull out the response body and write it
@@ -24,17 +24,33 @@ create table api.audit_log
 	request_header jsonb,
 	request_body text,
 	response_header jsonb,
-	response_body text
+	response_body text,
+	user_name varchar(100),
+	client_ip varchar(100),
+	forwarded_proto varchar(20),
+	forwarded_host varchar(100),
+	ua_name varchar(100),
+	ua_version varchar(50),
+	ua_os varchar(100),
+	ua_os_version varchar(50),
+	ua_device varchar(20),
+	ua_bot boolean,
+	phases jsonb,
+	attributes jsonb,
+	body_read_nanos bigint,
+	first_byte_nanos bigint,
+	handler_nanos bigint,
+	total_nanos bigint
 )
 ;
 
 alter table api.audit_log owner to gilcrest
 ;
 
-drop function api.log_request(varchar, varchar, timestamp, integer, timestamp, bigint, varchar, integer, integer, varchar, varchar, varchar, varchar, varchar, varchar, bigint, jsonb, text, jsonb, text)
+drop function api.log_request(varchar, varchar, timestamp, integer, timestamp, bigint, varchar, integer, integer, varchar, varchar, varchar, varchar, varchar, varchar, bigint, jsonb, text, jsonb, text, varchar, varchar, varchar, varchar, varchar, varchar, varchar, varchar, varchar, varchar, boolean, jsonb, jsonb, bigint, bigint, bigint, bigint)
 ;
 
-create function api.log_request(p_request_id character varying, p_client_id character varying, p_request_timestamp timestamp without time zone, p_response_code integer, p_response_timestamp timestamp without time zone, p_duration_in_millis bigint, p_protocol character varying, p_protocol_major integer, p_protocol_minor integer, p_request_method character varying, p_scheme character varying, p_host character varying, p_port character varying, p_path character varying, p_remote_address character varying, p_request_content_length bigint, p_request_header jsonb, p_request_body text, p_response_header jsonb, p_response_body text) returns integer
+create function api.log_request(p_request_id character varying, p_client_id character varying, p_request_timestamp timestamp without time zone, p_response_code integer, p_response_timestamp timestamp without time zone, p_duration_in_millis bigint, p_protocol character varying, p_protocol_major integer, p_protocol_minor integer, p_request_method character varying, p_scheme character varying, p_host character varying, p_port character varying, p_path character varying, p_remote_address character varying, p_request_content_length bigint, p_request_header jsonb, p_request_body text, p_response_header jsonb, p_response_body text, p_user_name character varying, p_client_ip character varying, p_forwarded_proto character varying, p_forwarded_host character varying, p_ua_name character varying, p_ua_version character varying, p_ua_os character varying, p_ua_os_version character varying, p_ua_device character varying, p_ua_bot boolean, p_phases jsonb, p_attributes jsonb, p_body_read_nanos bigint, p_first_byte_nanos bigint, p_handler_nanos bigint, p_total_nanos bigint) returns integer
 	language plpgsql
 as $$
 DECLARE
@@ -59,7 +75,23 @@ BEGIN
                             request_header,
                             request_body,
                             response_header,
-                            response_body
+                            response_body,
+                            user_name,
+                            client_ip,
+                            forwarded_proto,
+                            forwarded_host,
+                            ua_name,
+                            ua_version,
+                            ua_os,
+                            ua_os_version,
+                            ua_device,
+                            ua_bot,
+                            phases,
+                            attributes,
+                            body_read_nanos,
+                            first_byte_nanos,
+                            handler_nanos,
+                            total_nanos
                             )
 	  VALUES (p_request_id,
             p_client_id,
@@ -80,14 +112,31 @@ BEGIN
             p_request_header,
             p_request_body,
             p_response_header,
-            p_response_body
-            );
+            p_response_body,
+            p_user_name,
+            p_client_ip,
+            p_forwarded_proto,
+            p_forwarded_host,
+            p_ua_name,
+            p_ua_version,
+            p_ua_os,
+            p_ua_os_version,
+            p_ua_device,
+            p_ua_bot,
+            p_phases,
+            p_attributes,
+            p_body_read_nanos,
+            p_first_byte_nanos,
+            p_handler_nanos,
+            p_total_nanos
+            )
+  ON CONFLICT (request_id) DO NOTHING;
   GET DIAGNOSTICS v_rows_inserted = ROW_COUNT;
   return v_rows_inserted;
 END;
 $$
 ;
 
-alter function api.log_request(varchar, varchar, timestamp, integer, timestamp, bigint, varchar, integer, integer, varchar, varchar, varchar, varchar, varchar, varchar, bigint, jsonb, text, jsonb, text) owner to gilcrest
+alter function api.log_request(varchar, varchar, timestamp, integer, timestamp, bigint, varchar, integer, integer, varchar, varchar, varchar, varchar, varchar, varchar, bigint, jsonb, text, jsonb, text, varchar, varchar, varchar, varchar, varchar, varchar, varchar, varchar, varchar, varchar, boolean, jsonb, jsonb, bigint, bigint, bigint, bigint) owner to gilcrest
 ;
 
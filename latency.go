@@ -0,0 +1,86 @@
+package httplog
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// latency holds the points reached while serving a request. Each is
+// measured with the monotonic clock as an offset from received
+type latency struct {
+	// received is the time the middleware received the request. It
+	// keeps its monotonic clock reading, unlike tracker.timeStarted
+	// which is converted to UTC
+	received time.Time
+	// bodyRead is the time spent reading the request body
+	bodyRead time.Duration
+	// firstByte is when the handler first called WriteHeader, Write
+	// or Flush (or returned, if it wrote nothing)
+	firstByte time.Duration
+	// handled is when the handler returned
+	handled time.Duration
+	// written is when the response had been written to the client
+	written time.Duration
+}
+
+// millis returns d in milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// markFirstByte records the time to first byte, if it has not
+// already been recorded
+func (t *tracker) markFirstByte() {
+	if t.latency.firstByte == 0 {
+		t.latency.firstByte = time.Since(t.latency.received)
+	}
+}
+
+// markHandled records the time the handler returned
+func (t *tracker) markHandled() {
+	t.markFirstByte()
+	t.latency.handled = time.Since(t.latency.received)
+}
+
+// latencyDict returns the latency breakdown as a zerolog dictionary
+// of milliseconds
+func latencyDict(l latency) *zerolog.Event {
+	return zerolog.Dict().
+		Float64("body_read_ms", millis(l.bodyRead)).
+		Float64("first_byte_ms", millis(l.firstByte)).
+		Float64("handler_ms", millis(l.handled)).
+		Float64("total_ms", millis(l.written))
+}
+
+// firstByteWriter wraps the ResponseWriter passed to the handler to
+// record when the handler first writes to it
+type firstByteWriter struct {
+	http.ResponseWriter
+	t *tracker
+}
+
+// newFirstByteWriter returns w wrapped to record the time to first
+// byte in t
+func newFirstByteWriter(w http.ResponseWriter, t *tracker) http.ResponseWriter {
+	return &firstByteWriter{ResponseWriter: w, t: t}
+}
+
+func (w *firstByteWriter) WriteHeader(code int) {
+	w.t.markFirstByte()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *firstByteWriter) Write(b []byte) (int, error) {
+	w.t.markFirstByte()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (w *firstByteWriter) Flush() {
+	w.t.markFirstByte()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,87 @@
+package httplog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLogHandler_Latency(t *testing.T) {
+	opts := new(Opts)
+	opts.Option(LogResponse2Stdout(true, false, false))
+
+	var buf bytes.Buffer
+	lgr := zerolog.New(&buf).Level(zerolog.InfoLevel)
+
+	h := LogHandler(lgr, nil, opts)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://example.com:8080/", strings.NewReader(`{"a":1}`)))
+
+	var ev struct {
+		Message string `json:"message"`
+		Latency struct {
+			BodyRead  float64 `json:"body_read_ms"`
+			FirstByte float64 `json:"first_byte_ms"`
+			Handler   float64 `json:"handler_ms"`
+			Total     float64 `json:"total_ms"`
+		} `json:"latency"`
+	}
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if ev.Message == "Response Sent" {
+			break
+		}
+	}
+	if ev.Message != "Response Sent" {
+		t.Fatal("no Response Sent event logged")
+	}
+
+	l := ev.Latency
+	if l.FirstByte < 10 || l.FirstByte < l.BodyRead {
+		t.Errorf("first_byte_ms = %v, want >= 10 and >= body_read_ms %v", l.FirstByte, l.BodyRead)
+	}
+	if l.Handler < l.FirstByte+10 {
+		t.Errorf("handler_ms = %v, want >= first_byte_ms + 10 (%v)", l.Handler, l.FirstByte+10)
+	}
+	if l.Total < l.Handler {
+		t.Errorf("total_ms = %v, want >= handler_ms %v", l.Total, l.Handler)
+	}
+}
+
+func Test_newHAREntry_Latency(t *testing.T) {
+	tr := &tracker{
+		requestID:    "c5a5b9ma6806ln8iak8g",
+		duration:     10 * time.Millisecond,
+		responseCode: http.StatusOK,
+		latency: latency{
+			bodyRead:  1 * time.Millisecond,
+			firstByte: 7 * time.Millisecond,
+			handled:   9 * time.Millisecond,
+			written:   10 * time.Millisecond,
+		},
+	}
+
+	e := newHAREntry(zerolog.Nop(), tr, Log2HAR{})
+	if e.Timings.Send != 1 || e.Timings.Wait != 6 || e.Timings.Receive != 3 {
+		t.Errorf("Timings = %+v, want send 1, wait 6, receive 3", e.Timings)
+	}
+	if sum := e.Timings.Send + e.Timings.Wait + e.Timings.Receive; sum != e.Time {
+		t.Errorf("Timings sum to %v, want Time %v", sum, e.Time)
+	}
+}
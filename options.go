@@ -9,7 +9,41 @@ import (
 type Opts struct {
 	Log2StdOut Log2StdOut `json:"log_json"`
 	Log2DB     Log2DB     `json:"log_2DB"`
+	Log2File   Log2File   `json:"log_2file"`
+	Log2HAR    Log2HAR    `json:"log_2HAR"`
+	Log2Syslog Log2Syslog `json:"log_2syslog"`
 	HTTPUtil   HTTPUtil   `json:"httputil"`
+
+	// ResponseHeaders holds the headers the middleware sets on
+	// each response
+	ResponseHeaders ResponseHeaders `json:"response_headers"`
+
+	// TrustedProxies holds the CIDRs (or single IP addresses) of the
+	// proxies and load balancers trusted to set the Forwarded,
+	// X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host and
+	// X-Real-IP headers. These headers are ignored for requests
+	// sent from any other address. The middleware panics when it
+	// is built if any of them is not a valid CIDR or IP address.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+
+	// ParseUserAgent parses the User-Agent header of each request
+	// into the client name and version, OS, device class and a bot
+	// flag, which are logged as top-level fields and stored in the
+	// audit_log table.
+	ParseUserAgent bool `json:"parse_user_agent"`
+
+	// ClientIdentifier, if set, resolves the client id for each
+	// request. It cannot be set from the JSON options file.
+	ClientIdentifier ClientIdentifier `json:"-"`
+}
+
+// ResponseHeaders holds the options for the headers the middleware
+// sets on each response. Set RequestID to true to send the unique
+// request id in the X-Request-ID header. Set ServerTiming to true to
+// send a Server-Timing header with the time spent handling the request
+type ResponseHeaders struct {
+	RequestID    bool `json:"request_id"`
+	ServerTiming bool `json:"server_timing"`
 }
 
 // HTTPUtil struct hold the options for using
@@ -41,15 +75,97 @@ type L2SOpt struct {
 	Options ROpt
 }
 
+// Log2File (Log to File) struct holds the options for logging
+// requests and responses as JSON to a local file. Request and
+// Response work the same as they do for Log2StdOut. File holds
+// the location and rotation settings for the file
+type Log2File struct {
+	Request  L2SOpt
+	Response L2SOpt
+	File     FileOpt `json:"file"`
+}
+
+// FileOpt holds the options for the Log2File destination.
+// Path is the file to write to. The file is rotated when it grows
+// beyond MaxSizeMB megabytes or has been open for RotateMinutes
+// minutes, whichever comes first (0 disables either). Rotated files
+// are renamed with a timestamp suffix and gzip compressed if
+// Compress is true. At most MaxFiles rotated files are kept (0 keeps
+// all of them). The file is reopened when the process receives SIGHUP
+type FileOpt struct {
+	Path          string `json:"path"`
+	MaxSizeMB     int    `json:"max_size_mb"`
+	RotateMinutes int    `json:"rotate_minutes"`
+	MaxFiles      int    `json:"max_files"`
+	Compress      bool   `json:"compress"`
+}
+
+// Log2HAR struct holds the options for writing each request and
+// response as an HTTP Archive (HAR 1.2) entry to a local file.
+// Set Enable to true for any HAR logging and set the Request and
+// Response options according to whether you want headers and/or
+// body included in the entries. File holds the location and
+// rotation settings for the file; it must not be the same file
+// used by Log2File. Each line of the file is one JSON HAR entry,
+// use ReadHAR to turn the file into a HAR document
+type Log2HAR struct {
+	Enable   bool `json:"enable"`
+	Request  ROpt
+	Response ROpt
+	File     FileOpt `json:"file"`
+}
+
+// Log2Syslog struct holds the options for sending requests and
+// responses to a syslog server as RFC 5424 messages. Request and
+// Response work the same as they do for Log2StdOut. Syslog holds
+// the server and message settings
+type Log2Syslog struct {
+	Request  L2SOpt
+	Response L2SOpt
+	Syslog   SyslogOpt `json:"syslog"`
+}
+
+// SyslogOpt holds the options for the Log2Syslog destination.
+// Network is one of "udp", "tcp", "tls" or "unix" and Address is
+// the host:port (or socket path for unix) of the syslog server.
+// Messages sent over tcp and tls use octet counting framing.
+// Facility is a facility name such as "user", "daemon" or "local0"
+// through "local7" (defaults to "user") and AppName is sent as the
+// APP-NAME of each message (defaults to "httplog"). For tls,
+// TLSCAFile can be set to a PEM file of CA certificates used to
+// verify the server, otherwise the system roots are used
+type SyslogOpt struct {
+	Network   string `json:"network"`
+	Address   string `json:"address"`
+	Facility  string `json:"facility"`
+	AppName   string `json:"app_name"`
+	TLSCAFile string `json:"tls_ca_file"`
+}
+
 // Log2DB struct holds the options for logging to a database
 // Set Enable to true you want any database logging
 // Set the Request and Response options according to whether
 // you want to log request and/or response to the database
 // Requests/Responses will only be logged if Enable is true
+// Set the Spool options if you want records that fail to be
+// written to the database to be kept in a local file instead
 type Log2DB struct {
 	Enable   bool `json:"enable"`
 	Request  ROpt
 	Response ROpt
+	Spool    SpoolOpt `json:"spool"`
+}
+
+// SpoolOpt holds the options for the database logging spool file.
+// When Enable is true, any record that cannot be written to the
+// database is appended as a line of JSON to the file at Path. Set
+// Fsync to true to sync the file to disk after every write (safer,
+// but slower). Spooled records can be written to the database
+// later using ReplaySpool
+type SpoolOpt struct {
+	Enable bool   `json:"enable"`
+	Path   string `json:"path"`
+	Fsync  bool   `json:"fsync"`
 }
 
 // ROpt is the http request/response logging options
@@ -115,6 +231,110 @@ func LogResponse2Stdout(enable bool, header bool, body bool) option {
 	}
 }
 
+// LogRequest2File sets the options for logging http requests to
+// the file set with LogFile.
+// enable turns on the functionality
+// header logs http request headers
+// body logs the http request body
+func LogRequest2File(enable bool, header bool, body bool) option {
+	return func(o *Opts) {
+		o.Log2File.Request.Enable = enable
+		o.Log2File.Request.Options.Header = header
+		o.Log2File.Request.Options.Body = body
+	}
+}
+
+// LogResponse2File sets the options for logging http responses to
+// the file set with LogFile.
+// enable turns on the functionality
+// header logs http response headers
+// body logs the http response body
+func LogResponse2File(enable bool, header bool, body bool) option {
+	return func(o *Opts) {
+		o.Log2File.Response.Enable = enable
+		o.Log2File.Response.Options.Header = header
+		o.Log2File.Response.Options.Body = body
+	}
+}
+
+// LogFile sets the file and rotation options used when logging
+// requests or responses to a file.
+// path is the file to write to
+// maxSizeMB rotates the file once it grows beyond this many megabytes
+// rotateMinutes rotates the file once it has been open this long
+// maxFiles is the number of rotated files to keep
+// compress gzip compresses rotated files
+func LogFile(path string, maxSizeMB int, rotateMinutes int, maxFiles int, compress bool) option {
+	return func(o *Opts) {
+		o.Log2File.File.Path = path
+		o.Log2File.File.MaxSizeMB = maxSizeMB
+		o.Log2File.File.RotateMinutes = rotateMinutes
+		o.Log2File.File.MaxFiles = maxFiles
+		o.Log2File.File.Compress = compress
+	}
+}
+
+// LogRequest2Syslog sets the options for sending http requests to
+// the syslog server set with Syslog.
+// enable turns on the functionality
+// header logs http request headers
+// body logs the http request body
+func LogRequest2Syslog(enable bool, header bool, body bool) option {
+	return func(o *Opts) {
+		o.Log2Syslog.Request.Enable = enable
+		o.Log2Syslog.Request.Options.Header = header
+		o.Log2Syslog.Request.Options.Body = body
+	}
+}
+
+// LogResponse2Syslog sets the options for sending http responses to
+// the syslog server set with Syslog.
+// enable turns on the functionality
+// header logs http response headers
+// body logs the http response body
+func LogResponse2Syslog(enable bool, header bool, body bool) option {
+	return func(o *Opts) {
+		o.Log2Syslog.Response.Enable = enable
+		o.Log2Syslog.Response.Options.Header = header
+		o.Log2Syslog.Response.Options.Body = body
+	}
+}
+
+// Syslog sets the syslog server used when sending requests or
+// responses to syslog.
+// network is one of udp, tcp, tls or unix
+// address is the host:port or socket path of the server
+// facility is the syslog facility name, e.g. local0
+// appName is the APP-NAME sent with each message
+func Syslog(network string, address string, facility string, appName string) option {
+	return func(o *Opts) {
+		o.Log2Syslog.Syslog.Network = network
+		o.Log2Syslog.Syslog.Address = address
+		o.Log2Syslog.Syslog.Facility = facility
+		o.Log2Syslog.Syslog.AppName = appName
+	}
+}
+
+// Log2HARFile sets the options for writing requests and responses
+// as HAR entries to a file.
+// enable turns on the functionality
+// path is the file to write to
+// reqHdr includes http request headers
+// reqBody includes the http request body
+// respHdr includes http response headers
+// respBody includes the http response body
+// Use the Log2HAR.File fields directly to set rotation options.
+func Log2HARFile(enable bool, path string, reqHdr bool, reqBody bool, respHdr bool, respBody bool) option {
+	return func(o *Opts) {
+		o.Log2HAR.Enable = enable
+		o.Log2HAR.File.Path = path
+		o.Log2HAR.Request.Header = reqHdr
+		o.Log2HAR.Request.Body = reqBody
+		o.Log2HAR.Response.Header = respHdr
+		o.Log2HAR.Response.Body = respBody
+	}
+}
+
 // Log2Database sets the options for logging to the database.
 // enable turns on the functionality - if this is set to false, the
 // parameters afterward are irrelevant as nothing will log.
@@ -132,6 +352,58 @@ func Log2Database(enable bool, reqHdr bool, reqBody bool, respHdr bool, respBody
 	}
 }
 
+// SpoolDBFailures sets the options for spooling database log records
+// to a local file when the database write fails.
+// enable turns on the functionality
+// path is the location of the spool file
+// fsync syncs the spool file to disk after each record is written
+func SpoolDBFailures(enable bool, path string, fsync bool) option {
+	return func(o *Opts) {
+		o.Log2DB.Spool.Enable = enable
+		o.Log2DB.Spool.Path = path
+		o.Log2DB.Spool.Fsync = fsync
+	}
+}
+
+// TrustProxies sets the CIDRs (or single IP addresses) of the
+// proxies trusted to set forwarding headers, which are used to
+// resolve the real client IP address, protocol and host.
+func TrustProxies(cidrs ...string) option {
+	return func(o *Opts) {
+		o.TrustedProxies = cidrs
+	}
+}
+
+// SetResponseHeaders sets the headers the middleware adds to each
+// response.
+// requestID sends the request id in the X-Request-ID header
+// serverTiming sends the request timings in the Server-Timing header
+func SetResponseHeaders(requestID, serverTiming bool) option {
+	return func(o *Opts) {
+		o.ResponseHeaders.RequestID = requestID
+		o.ResponseHeaders.ServerTiming = serverTiming
+	}
+}
+
+// LogUserAgent turns on parsing of the User-Agent header into
+// structured fields for each request. See ParseUserAgent.
+func LogUserAgent(enable bool) option {
+	return func(o *Opts) {
+		o.ParseUserAgent = enable
+	}
+}
+
+// IdentifyClient sets the ClientIdentifier used to resolve the
+// client id for each request. Use one of the provided identifiers
+// (APIKeyClientIdentifier, JWTClientIdentifier, ClientCertIdentifier,
+// BasicAuthClientIdentifier), combine them with ClientIdentifiers
+// or write your own.
+func IdentifyClient(ci ClientIdentifier) option {
+	return func(o *Opts) {
+		o.ClientIdentifier = ci
+	}
+}
+
 // LogRequestViaHTTPUtil sets the options for logging requests
 // using the standard HTTPUtil package
 // enable turns on the functionality
@@ -0,0 +1,121 @@
+package httplog
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// phase is the total time spent in one named phase of a request,
+// which may have been started more than once
+type phase struct {
+	name  string
+	dur   time.Duration
+	count int
+}
+
+// millis returns the phase duration in milliseconds
+func (p phase) millis() float64 {
+	return float64(p.dur) / float64(time.Millisecond)
+}
+
+// StartPhase starts timing a named phase of the request (e.g. "db",
+// "cache" or "upstream") and returns a function which stops it.
+// Phases started more than once with the same name are added
+// together. The phases are logged in the "Response Sent" event,
+// stored in the phases column of the audit table and, if
+// Opts.ResponseHeaders.ServerTiming is set, sent in the Server-Timing
+// header. StartPhase is safe to call from multiple goroutines. If
+// ctx did not come through the middleware, the phase is not recorded.
+//
+//	stop := httplog.StartPhase(ctx, "db")
+//	rows, err := db.QueryContext(ctx, q)
+//	stop()
+func StartPhase(ctx context.Context, name string) (stop func()) {
+	s := stateFromContext(ctx)
+	if s == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.addPhase(name, time.Since(start))
+		})
+	}
+}
+
+// addPhase adds d to the phase called name, in the order each
+// phase was first recorded
+func (s *requestState) addPhase(name string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.phases {
+		if s.phases[i].name == name {
+			s.phases[i].dur += d
+			s.phases[i].count++
+			return
+		}
+	}
+	s.phases = append(s.phases, phase{name: name, dur: d, count: 1})
+}
+
+// Phases returns a copy of the phases recorded with StartPhase
+func (s *requestState) Phases() []phase {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]phase(nil), s.phases...)
+}
+
+// phasesDict returns the phases as a zerolog dictionary of phase
+// name to milliseconds
+func phasesDict(phases []phase) *zerolog.Event {
+	d := zerolog.Dict()
+	for _, p := range phases {
+		d.Float64(p.name, p.millis())
+	}
+	return d
+}
+
+// phasesJSON returns the phases as a JSON object of phase name to
+// milliseconds and count, or an empty string if there are none
+func phasesJSON(log zerolog.Logger, phases []phase) string {
+	if len(phases) == 0 {
+		return ""
+	}
+
+	type phaseJSON struct {
+		DurationMillis float64 `json:"dur_ms"`
+		Count          int     `json:"count"`
+	}
+	m := make(map[string]phaseJSON, len(phases))
+	for _, p := range phases {
+		m[p.name] = phaseJSON{DurationMillis: p.millis(), Count: p.count}
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		log.Error().Err(err).Msg("phases not stored")
+		return ""
+	}
+	return string(b)
+}
+
+// serverTimingName makes name safe to use as a Server-Timing metric
+// name, which must be an HTTP token
+func serverTimingName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0x20 && r < 0x7f && !strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
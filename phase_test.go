@@ -0,0 +1,77 @@
+package httplog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestStartPhase(t *testing.T) {
+	ctx, aud := newTestRequestContext(t, nil, zerolog.Nop())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stop := StartPhase(ctx, "db")
+			time.Sleep(5 * time.Millisecond)
+			stop()
+			stop() // stopping twice has no effect
+		}()
+	}
+	wg.Wait()
+	StartPhase(ctx, "cache")()
+
+	phases := aud.state.Phases()
+	if len(phases) != 2 {
+		t.Fatalf("Phases() = %v, want 2 phases", phases)
+	}
+	if p := phases[0]; p.name != "db" || p.count != 2 || p.dur < 10*time.Millisecond {
+		t.Errorf("db phase = %+v, want count 2 and dur >= 10ms", p)
+	}
+	if p := phases[1]; p.name != "cache" || p.count != 1 {
+		t.Errorf("cache phase = %+v, want count 1", p)
+	}
+
+	var got map[string]struct {
+		DurationMillis float64 `json:"dur_ms"`
+		Count          int     `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(newDBRecord(zerolog.Nop(), aud, new(Opts)).Phases), &got); err != nil {
+		t.Fatalf("dbRecord Phases is not valid JSON: %v", err)
+	}
+	if got["db"].Count != 2 || got["db"].DurationMillis < 10 {
+		t.Errorf("dbRecord Phases db = %+v", got["db"])
+	}
+}
+
+func TestStartPhase_NoMiddleware(t *testing.T) {
+	// must not panic
+	StartPhase(context.Background(), "db")()
+}
+
+func TestLogHandler_ServerTimingPhases(t *testing.T) {
+	opts := new(Opts)
+	opts.Option(SetResponseHeaders(false, true))
+
+	h := LogHandler(zerolog.Nop(), nil, opts)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		StartPhase(req.Context(), "db")()
+		StartPhase(req.Context(), "up stream")()
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com:8080/", nil))
+
+	want := regexp.MustCompile(`^db;dur=[\d.]+, up_stream;dur=[\d.]+, total;dur=[\d.]+$`)
+	if got := w.Header().Get("Server-Timing"); !want.MatchString(got) {
+		t.Errorf("Server-Timing = %q, want match for %s", got, want)
+	}
+}
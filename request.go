@@ -30,7 +30,33 @@ func requestLogController(ctx context.Context, log zerolog.Logger, t *tracker, r
 	}
 
 	if opts.Log2StdOut.Request.Enable {
-		err = logReq2Stdout(log, t, opts)
+		err = logReq2Stdout(log, t, opts.Log2StdOut.Request.Options)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return err
+		}
+	}
+
+	if opts.Log2File.Request.Enable {
+		flog, err := fileLogger(opts.Log2File.File)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return err
+		}
+		err = logReq2Stdout(flog, t, opts.Log2File.Request.Options)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return err
+		}
+	}
+
+	if opts.Log2Syslog.Request.Enable {
+		slog, err := syslogLogger(opts.Log2Syslog.Syslog, "request")
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return err
+		}
+		err = logReq2Stdout(slog, t, opts.Log2Syslog.Request.Options)
 		if err != nil {
 			log.Error().Err(err).Msg("")
 			return err
@@ -136,7 +162,9 @@ func dumpBody(req *http.Request) (string, error) {
 // 	return lgr, nil
 // }
 
-func logReq2Stdout(log zerolog.Logger, t *tracker, opts *Opts) error {
+// logReq2Stdout writes the "Request Received" event to the given
+// logger. Headers and body are only written if enabled in o
+func logReq2Stdout(log zerolog.Logger, t *tracker, o ROpt) error {
 
 	// logger, err = logFormValues(logger, req)
 	// if err != nil {
@@ -144,16 +172,19 @@ func logReq2Stdout(log zerolog.Logger, t *tracker, opts *Opts) error {
 	// }
 
 	// All header key:value pairs written to JSON
-	if opts.Log2StdOut.Request.Options.Header {
+	if o.Header {
 		log = log.With().Str("header_json", t.request.header).Logger()
 	}
 
-	if opts.Log2StdOut.Request.Options.Body {
+	if o.Body {
 		log = log.With().Str("body", t.request.body).Logger()
 	}
 
+	log = withUserAgent(log, t.request.ua)
+
 	log.Info().
 		Str("request_id", t.requestID).
+		Str("client_id", t.clientID).
 		Str("method", t.request.method).
 		// most url.URL components split out
 		Str("scheme", t.request.scheme).
@@ -168,6 +199,9 @@ func logReq2Stdout(log zerolog.Logger, t *tracker, opts *Opts) error {
 		Str("transfer_encoding", t.request.transferEncoding).
 		Bool("close", t.request.close).
 		Str("remote_Addr", t.request.remoteAddr).
+		Str("client_ip", t.request.clientIP).
+		Str("forwarded_proto", t.request.forwardedProto).
+		Str("forwarded_host", t.request.forwardedHost).
 		Str("request_URI", t.request.requestURI).
 		Msg("Request Received")
 
@@ -3,93 +3,255 @@ package httplog
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 // logRespController determines which, if any, of the logging methods
-// you wish to use will be employed
+// you wish to use will be employed. A failing destination is logged
+// and the remaining ones are still attempted, so a broken log file or
+// syslog server never keeps a record out of the database (or spool).
+// The errors of all failing destinations are returned together
 func responseLogController(ctx context.Context, log zerolog.Logger, db *sql.DB, t *tracker, opts *Opts) error {
 
+	var failed sinkErrors
+
 	if opts.Log2StdOut.Response.Enable {
-		logResp2Stdout(log, t)
+		// stdout has always logged the response header and body
+		logResp2Stdout(log, t, ROpt{Header: true, Body: true})
+	}
+
+	if opts.Log2File.Response.Enable {
+		flog, err := fileLogger(opts.Log2File.File)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			failed = append(failed, err)
+		} else {
+			logResp2Stdout(flog, t, opts.Log2File.Response.Options)
+		}
+	}
+
+	if opts.Log2Syslog.Response.Enable {
+		slog, err := syslogLogger(opts.Log2Syslog.Syslog, "response")
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			failed = append(failed, err)
+		} else {
+			logResp2Stdout(slog, t, opts.Log2Syslog.Response.Options)
+		}
+	}
+
+	if opts.Log2HAR.Enable {
+		err := logReqResp2HAR(log, t, opts.Log2HAR)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			failed = append(failed, err)
+		}
 	}
 
 	if opts.Log2DB.Enable {
-		err := logReqResp2Db(ctx, db, t, opts)
+		err := logReqResp2Db(ctx, log, db, t, opts)
 		if err != nil {
 			log.Error().Err(err).Msg("")
-			return err
+			// if spooling is enabled, the record is appended to the
+			// spool file so it can be replayed later with ReplaySpool
+			if !opts.Log2DB.Spool.Enable {
+				failed = append(failed, err)
+				return failed.err()
+			}
+			serr := spoolRecord(opts.Log2DB.Spool, newDBRecord(log, t, opts))
+			if serr != nil {
+				log.Error().Err(serr).Msg("")
+				failed = append(failed, serr)
+				return failed.err()
+			}
+			log.Warn().Err(err).
+				Str("request_id", t.requestID).
+				Str("spool_path", opts.Log2DB.Spool.Path).
+				Msg("database logging failed, record spooled")
 		}
 	}
-	return nil
+	return failed.err()
+}
+
+// sinkErrors collects the errors of the log destinations
+type sinkErrors []error
+
+// err returns nil if there are no errors, the error if there is
+// one, or else a single error listing them all
+func (se sinkErrors) err() error {
+	switch len(se) {
+	case 0:
+		return nil
+	case 1:
+		return se[0]
+	}
+	msgs := make([]string, len(se))
+	for i, err := range se {
+		msgs[i] = err.Error()
+	}
+	return errors.Errorf("%d log destinations failed: %s", len(se), strings.Join(msgs, "; "))
 }
 
-func logResp2Stdout(log zerolog.Logger, t *tracker) {
+// logResp2Stdout writes the "Response Sent" event to the given
+// logger. Headers and body are only written if enabled in o (for
+// stdout they always are)
+func logResp2Stdout(log zerolog.Logger, t *tracker, o ROpt) {
 
 	log.Debug().Msg("logResponse started")
 	defer log.Debug().Msg("logResponse ended")
 
+	if o.Header {
+		log = log.With().Str("response_header", t.response.header).Logger()
+	}
+
+	if o.Body {
+		log = log.With().Str("response_body", t.response.body).Logger()
+	}
+
+	log = withUserAgent(log, t.request.ua)
+
+	if phases := t.state.Phases(); len(phases) > 0 {
+		log = log.With().Dict("phases", phasesDict(phases)).Logger()
+	}
+
+	if fields := t.state.Fields(); len(fields) > 0 {
+		lc := log.With()
+		for _, f := range fields {
+			lc = lc.Interface(f.key, f.value)
+		}
+		log = lc.Logger()
+	}
+
 	log.Info().
 		Str("request_id", t.requestID).
+		Str("client_id", t.clientID).
+		Str("user", string(t.state.User())).
 		Int("response_code", t.responseCode).
-		Str("response_header", t.response.header).
-		Str("response_body", t.response.body).
+		Dict("latency", latencyDict(t.latency)).
 		Msg("Response Sent")
 }
 
-// logReqResp2Db creates a record in the api.audit_log table
-// using a stored function
-func logReqResp2Db(ctx context.Context, db *sql.DB, t *tracker, opts *Opts) error {
-
-	var (
-		rowsInserted int
-		respHdr      interface{}
-		respBody     interface{}
-		reqHdr       interface{}
-		reqBody      interface{}
-	)
-
-	// default reqHdr variable to nil
-	// if the Request Header logging option is enabled for db logging
-	// then check if the header string is it's zero value and if so,
-	// switch it to nil, otherwise write it to the variable
-	reqHdr = nil
+// dbRecord holds the values written to the api.audit_log table.
+// Header and body values are only populated if the corresponding
+// Log2DB option is enabled. dbRecord is also the format used for
+// each line of the spool file (see spool.go), so all fields are
+// exported to encoding/json.
+type dbRecord struct {
+	RequestID            string    `json:"request_id"`
+	ClientID             string    `json:"client_id,omitempty"`
+	UserName             string    `json:"user_name,omitempty"`
+	RequestTimestamp     time.Time `json:"request_timestamp"`
+	ResponseCode         int       `json:"response_code"`
+	ResponseTimestamp    time.Time `json:"response_timestamp"`
+	DurationInMillis     int64     `json:"duration_in_millis"`
+	Protocol             string    `json:"protocol"`
+	ProtocolMajor        int       `json:"protocol_major"`
+	ProtocolMinor        int       `json:"protocol_minor"`
+	RequestMethod        string    `json:"request_method"`
+	Scheme               string    `json:"scheme"`
+	Host                 string    `json:"host"`
+	Port                 string    `json:"port"`
+	Path                 string    `json:"path"`
+	RemoteAddress        string    `json:"remote_address"`
+	ClientIP             string    `json:"client_ip,omitempty"`
+	ForwardedProto       string    `json:"forwarded_proto,omitempty"`
+	ForwardedHost        string    `json:"forwarded_host,omitempty"`
+	RequestContentLength int64     `json:"request_content_length"`
+	RequestHeader        string    `json:"request_header,omitempty"`
+	RequestBody          string    `json:"request_body,omitempty"`
+	ResponseHeader       string    `json:"response_header,omitempty"`
+	ResponseBody         string    `json:"response_body,omitempty"`
+	UAName               string    `json:"ua_name,omitempty"`
+	UAVersion            string    `json:"ua_version,omitempty"`
+	UAOS                 string    `json:"ua_os,omitempty"`
+	UAOSVersion          string    `json:"ua_os_version,omitempty"`
+	UADevice             string    `json:"ua_device,omitempty"`
+	UABot                *bool     `json:"ua_bot,omitempty"`
+	Phases               string    `json:"phases,omitempty"`
+	Attributes           string    `json:"attributes,omitempty"`
+	BodyReadNanos        int64     `json:"body_read_nanos"`
+	FirstByteNanos       int64     `json:"first_byte_nanos"`
+	HandlerNanos         int64     `json:"handler_nanos"`
+	TotalNanos           int64     `json:"total_nanos"`
+}
+
+// newDBRecord builds a dbRecord from the tracker, honoring the
+// Log2DB header and body options
+func newDBRecord(log zerolog.Logger, t *tracker, opts *Opts) dbRecord {
+	r := dbRecord{
+		RequestID:         t.requestID,
+		ClientID:          t.clientID,
+		UserName:          string(t.state.User()),
+		RequestTimestamp:  t.timeStarted,
+		ResponseCode:      t.responseCode,
+		ResponseTimestamp: t.timeFinished,
+		// time.Duration is in nanoseconds,
+		// need to do below math for milliseconds
+		DurationInMillis:     int64(t.duration / time.Millisecond),
+		Protocol:             t.request.proto,
+		ProtocolMajor:        t.request.protoMajor,
+		ProtocolMinor:        t.request.protoMinor,
+		RequestMethod:        t.request.method,
+		Scheme:               t.request.scheme,
+		Host:                 t.request.host,
+		Port:                 t.request.port,
+		Path:                 t.request.path,
+		RemoteAddress:        t.request.remoteAddr,
+		ClientIP:             t.request.clientIP,
+		ForwardedProto:       t.request.forwardedProto,
+		ForwardedHost:        t.request.forwardedHost,
+		RequestContentLength: t.request.contentLength,
+		Phases:               phasesJSON(log, t.state.Phases()),
+		Attributes:           fieldsJSON(log, t.state.Fields()),
+		BodyReadNanos:        int64(t.latency.bodyRead),
+		FirstByteNanos:       int64(t.latency.firstByte),
+		HandlerNanos:         int64(t.latency.handled),
+		TotalNanos:           int64(t.latency.written),
+	}
+
+	if ua := t.request.ua; ua != nil {
+		r.UAName = ua.Name
+		r.UAVersion = ua.Version
+		r.UAOS = ua.OS
+		r.UAOSVersion = ua.OSVersion
+		r.UADevice = ua.Device
+		r.UABot = &ua.Bot
+	}
+
 	if opts.Log2DB.Request.Header {
-		// This empty string to nil conversion is probably
-		// not necessary, but just in case to avoid db exception
-		reqHdr = strNil(t.request.header)
-	}
-	// default reqBody variable to nil
-	// if the Request Body logging option is enabled for db logging
-	// then check if the header string is it's zero value and if so,
-	// switch it to nil, otherwise write it to the variable
-	reqBody = nil
+		r.RequestHeader = t.request.header
+	}
 	if opts.Log2DB.Request.Body {
-		reqBody = strNil(t.request.body)
+		r.RequestBody = t.request.body
 	}
-	// default respHdr variable to nil
-	// if the Response Header logging option is enabled for db logging
-	// then check if the header string is it's zero value and if so,
-	// switch it to nil, otherwise write it to the variable
-	respHdr = nil
 	if opts.Log2DB.Response.Header {
-		respHdr = strNil(t.response.header)
+		r.ResponseHeader = t.response.header
 	}
-	// default respBody variable to nil
-	// if the Response Body logging option is enabled for db logging
-	// then check if the header string is it's zero value and if so,
-	// switch it to nil, otherwise write it to the variable
-	respBody = nil
 	if opts.Log2DB.Response.Body {
-		respBody = strNil(t.response.body)
+		r.ResponseBody = t.response.body
 	}
 
-	// time.Duration is in nanoseconds,
-	// need to do below math for milliseconds
-	durMS := t.duration / time.Millisecond
+	return r
+}
+
+// logReqResp2Db creates a record in the api.audit_log table
+// using a stored function
+func logReqResp2Db(ctx context.Context, log zerolog.Logger, db *sql.DB, t *tracker, opts *Opts) error {
+	return insertDBRecord(ctx, db, newDBRecord(log, t, opts))
+}
+
+// insertDBRecord writes a dbRecord to the api.audit_log table
+// using a stored function. The stored function ignores records
+// whose request_id already exists, so inserting the same record
+// more than once is harmless.
+func insertDBRecord(ctx context.Context, db *sql.DB, r dbRecord) error {
+
+	var rowsInserted int
 
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
@@ -116,38 +278,74 @@ func logReqResp2Db(ctx context.Context, db *sql.DB, t *tracker, opts *Opts) erro
 		p_request_header => $17,
 		p_request_body => $18,
 		p_response_header => $19,
-		p_response_body => $20)`)
+		p_response_body => $20,
+		p_user_name => $21,
+		p_client_ip => $22,
+		p_forwarded_proto => $23,
+		p_forwarded_host => $24,
+		p_ua_name => $25,
+		p_ua_version => $26,
+		p_ua_os => $27,
+		p_ua_os_version => $28,
+		p_ua_device => $29,
+		p_ua_bot => $30,
+		p_phases => $31,
+		p_attributes => $32,
+		p_body_read_nanos => $33,
+		p_first_byte_nanos => $34,
+		p_handler_nanos => $35,
+		p_total_nanos => $36)`)
 
 	if err != nil {
 		log.Error().Err(err).Msg("")
+		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
+	// The empty string to nil conversion for the header and body
+	// fields avoids passing an empty string to a jsonb parameter
 	rows, err := stmt.QueryContext(ctx,
-		t.requestID,             //$1
-		t.clientID,              //$2
-		t.timeStarted,           //$3
-		t.responseCode,          //$4
-		t.timeFinished,          //$5
-		durMS,                   //$6
-		t.request.proto,         //$7
-		t.request.protoMajor,    //$8
-		t.request.protoMinor,    //$9
-		t.request.method,        //$10
-		t.request.scheme,        //$11
-		t.request.host,          //$12
-		t.request.port,          //$13
-		t.request.path,          //$14
-		t.request.remoteAddr,    //$15
-		t.request.contentLength, //$16
-		reqHdr,                  //$17
-		reqBody,                 //$18
-		respHdr,                 //$19
-		respBody)                //$20
+		r.RequestID,              //$1
+		r.ClientID,               //$2
+		r.RequestTimestamp,       //$3
+		r.ResponseCode,           //$4
+		r.ResponseTimestamp,      //$5
+		r.DurationInMillis,       //$6
+		r.Protocol,               //$7
+		r.ProtocolMajor,          //$8
+		r.ProtocolMinor,          //$9
+		r.RequestMethod,          //$10
+		r.Scheme,                 //$11
+		r.Host,                   //$12
+		r.Port,                   //$13
+		r.Path,                   //$14
+		r.RemoteAddress,          //$15
+		r.RequestContentLength,   //$16
+		strNil(r.RequestHeader),  //$17
+		strNil(r.RequestBody),    //$18
+		strNil(r.ResponseHeader), //$19
+		strNil(r.ResponseBody),   //$20
+		strNil(r.UserName),       //$21
+		strNil(r.ClientIP),       //$22
+		strNil(r.ForwardedProto), //$23
+		strNil(r.ForwardedHost),  //$24
+		strNil(r.UAName),         //$25
+		strNil(r.UAVersion),      //$26
+		strNil(r.UAOS),           //$27
+		strNil(r.UAOSVersion),    //$28
+		strNil(r.UADevice),       //$29
+		r.UABot,                  //$30
+		strNil(r.Phases),         //$31
+		strNil(r.Attributes),     //$32
+		r.BodyReadNanos,          //$33
+		r.FirstByteNanos,         //$34
+		r.HandlerNanos,           //$35
+		r.TotalNanos)             //$36
 
 	if err != nil {
 		log.Error().Err(err).Msg("")
+		tx.Rollback()
 		return err
 	}
 	defer rows.Close()
@@ -156,6 +354,7 @@ func logReqResp2Db(ctx context.Context, db *sql.DB, t *tracker, opts *Opts) erro
 	for rows.Next() {
 		if err := rows.Scan(&rowsInserted); err != nil {
 			log.Error().Err(err).Msg("")
+			tx.Rollback()
 			return err
 		}
 	}
@@ -163,6 +362,7 @@ func logReqResp2Db(ctx context.Context, db *sql.DB, t *tracker, opts *Opts) erro
 	err = rows.Err()
 	if err != nil {
 		log.Error().Err(err).Msg("")
+		tx.Rollback()
 		return err
 	}
 
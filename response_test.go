@@ -0,0 +1,56 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func Test_responseLogController_ContinuesAfterFailure(t *testing.T) {
+	harPath := filepath.Join(t.TempDir(), "audit.har.jsonl")
+
+	opts := new(Opts)
+	opts.Log2File.Response.Enable = true // no path, so the file sink fails
+	opts.Log2HAR = Log2HAR{Enable: true, File: FileOpt{Path: harPath}}
+
+	trk := &tracker{requestID: "c0ffee", responseCode: 200}
+
+	err := responseLogController(context.Background(), zerolog.Nop(), nil, trk, opts)
+	if err == nil {
+		t.Error("responseLogController() error = nil, want the file sink error")
+	}
+
+	b, rerr := os.ReadFile(harPath)
+	if rerr != nil {
+		t.Fatalf("HAR file not written after the file sink failed: %v", rerr)
+	}
+	if !strings.Contains(string(b), `"c0ffee"`) {
+		t.Errorf("HAR file = %s, want the request", b)
+	}
+}
+
+func Test_responseLogController_StdoutHeaderBody(t *testing.T) {
+	var buf bytes.Buffer
+	opts := new(Opts)
+	opts.Option(LogResponse2Stdout(true, false, false))
+
+	trk := &tracker{requestID: "c0ffee", responseCode: 200}
+	trk.response.header = `{"Content-Type":["application/json"]}`
+	trk.response.body = `{"id":1}`
+
+	if err := responseLogController(context.Background(), zerolog.New(&buf), nil, trk, opts); err != nil {
+		t.Fatalf("responseLogController() error = %v", err)
+	}
+
+	// stdout has always logged the response header and body
+	for _, want := range []string{`"response_header":`, `"response_body":`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log = %s, want it to contain %s", buf.String(), want)
+		}
+	}
+}
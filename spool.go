@@ -0,0 +1,299 @@
+package httplog
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// spoolMu serializes access to spool files. Records are appended
+// by concurrent requests and ReplaySpool rewrites the file, so a
+// single lock is held for both
+var spoolMu sync.Mutex
+
+// spoolRecord appends a dbRecord as a single JSON line to the spool
+// file. If the Fsync option is set, the file is synced to stable
+// storage before returning
+func spoolRecord(so SpoolOpt, r dbRecord) error {
+	if so.Path == "" {
+		return errors.New("spool path is empty")
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+
+	f, err := os.OpenFile(so.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	if err == nil && so.Fsync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// ReplaySpool writes the records held in the spool file at path to
+// the database. It is meant to be run once the database is healthy
+// again, either at startup or from a recovery job. Records are
+// inserted using the same stored function as Log2DB; records whose
+// request_id already exists in api.audit_log are ignored, so
+// replaying a spool more than once is safe.
+//
+// Successfully replayed records are removed from the spool file.
+// Lines that cannot be decoded, or that the database rejects as bad
+// data (SQLSTATE class 22 or 23), are moved to path + ".rejected" and
+// replay continues with the rest. If a record fails to insert for
+// any other reason (connection errors, too many connections, the
+// database shutting down, context cancellation), replay stops and
+// that record and any after it are kept for the next attempt. Records
+// spooled while the replay is running are kept as well. ReplaySpool
+// returns the number of records replayed.
+func ReplaySpool(ctx context.Context, db *sql.DB, path string) (int, error) {
+	return replaySpool(ctx, path, func(ctx context.Context, r dbRecord) error {
+		return insertDBRecord(ctx, db, r)
+	})
+}
+
+// replayMu serializes replays, so two replays of the same spool do
+// not pick up the same snapshot. It is never held with spoolMu while
+// records are inserted, so requests can keep spooling during a replay
+var replayMu sync.Mutex
+
+// replaySpool moves the spool file to a snapshot file under spoolMu,
+// then reads each line of the snapshot and passes the decoded record
+// to insert without holding the lock. Lines that have not been
+// replayed are merged back in front of any records spooled in the
+// meantime; if none remain, the spool file is removed
+func replaySpool(ctx context.Context, path string, insert func(context.Context, dbRecord) error) (int, error) {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	snapshot := path + ".replay"
+	if err := snapshotSpool(path, snapshot); err != nil {
+		return 0, err
+	}
+
+	lines, err := readSpool(snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		n        int
+		pending  [][]byte
+		rejected [][]byte
+	)
+	for i, line := range lines {
+		var r dbRecord
+		if jerr := json.Unmarshal(line, &r); jerr != nil {
+			rejected = append(rejected, line)
+			continue
+		}
+		ierr := insert(ctx, r)
+		if ierr == nil {
+			n++
+			continue
+		}
+		if rejectedDBError(ierr) {
+			rejected = append(rejected, line)
+			continue
+		}
+		err = errors.Wrapf(ierr, "replay of spool line %d failed", i+1)
+		pending = lines[i:]
+		break
+	}
+
+	if rerr := appendSpool(path+".rejected", rejected); rerr != nil {
+		// keep the rejected lines in the spool rather than lose them
+		pending = append(rejected, pending...)
+		if err == nil {
+			err = rerr
+		}
+	}
+
+	if merr := mergeSpool(path, snapshot, pending); merr != nil {
+		return n, merr
+	}
+
+	return n, err
+}
+
+// snapshotSpool moves the spool file to snapshot, so records spooled
+// while the snapshot is replayed go to a new spool file. A snapshot
+// left behind by an interrupted replay is kept and the spool file is
+// appended to it
+func snapshotSpool(path, snapshot string) error {
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+
+	if _, err := os.Stat(snapshot); os.IsNotExist(err) {
+		err = os.Rename(path, snapshot)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	lines, err := readSpool(path)
+	if err != nil {
+		return err
+	}
+	if err = appendSpool(snapshot, lines); err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// mergeSpool writes the pending lines of a snapshot back to the spool
+// file, ahead of any records spooled since the snapshot was taken,
+// and removes the snapshot
+func mergeSpool(path, snapshot string, pending [][]byte) error {
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+
+	spooled, err := readSpool(path)
+	if err != nil {
+		return err
+	}
+	if err = rewriteSpool(path, append(pending, spooled...)); err != nil {
+		return err
+	}
+
+	err = os.Remove(snapshot)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// readSpool returns the non-empty lines of the spool file at path. A
+// missing file has no lines
+func readSpool(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		lines = append(lines, append([]byte(nil), sc.Bytes()...))
+	}
+
+	return lines, sc.Err()
+}
+
+// appendSpool appends lines to the file at path, creating it if needed
+func appendSpool(path string, lines [][]byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// rejectedDBError reports whether err means the database rejected
+// the record itself, so inserting it again would fail the same way.
+// Only data exceptions (SQLSTATE class 22, e.g. a value too long for
+// its column) and integrity constraint violations (class 23) count;
+// any other error, such as the database being unreachable or
+// refusing connections (classes 08, 53 and 57), may clear up, so the
+// record is kept for the next replay. The SQLSTATE is read from
+// drivers' errors through their SQLState method (lib/pq, pgx)
+func rejectedDBError(err error) bool {
+	var se interface{ SQLState() string }
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch state := se.SQLState(); {
+	case strings.HasPrefix(state, "22"), strings.HasPrefix(state, "23"):
+		return true
+	}
+	return false
+}
+
+// rewriteSpool replaces the spool file with the given lines. The
+// new content is written to a temporary file which is then renamed
+// over the spool file, so a crash never leaves a partial spool
+func rewriteSpool(path string, lines [][]byte) error {
+	if len(lines) == 0 {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,158 @@
+package httplog
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_replaySpool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.spool")
+	so := SpoolOpt{Enable: true, Path: path, Fsync: true}
+
+	for _, id := range []string{"req1", "req2", "req3"} {
+		if err := spoolRecord(so, dbRecord{RequestID: id, Host: "example.com"}); err != nil {
+			t.Fatalf("spoolRecord() error = %v", err)
+		}
+	}
+
+	// first replay fails on req2, so req2 and req3 stay in the spool
+	var got []string
+	insert := func(ctx context.Context, r dbRecord) error {
+		if r.RequestID == "req2" {
+			return errors.Wrap(driver.ErrBadConn, "database unavailable")
+		}
+		got = append(got, r.RequestID)
+		return nil
+	}
+	n, err := replaySpool(context.Background(), path, insert)
+	if err == nil {
+		t.Fatal("replaySpool() error = nil, want error")
+	}
+	if n != 1 || len(got) != 1 || got[0] != "req1" {
+		t.Fatalf("replaySpool() replayed %d %v, want 1 [req1]", n, got)
+	}
+
+	// second replay succeeds and removes the spool file
+	got = nil
+	insert = func(ctx context.Context, r dbRecord) error {
+		got = append(got, r.RequestID)
+		return nil
+	}
+	n, err = replaySpool(context.Background(), path, insert)
+	if err != nil {
+		t.Fatalf("replaySpool() error = %v", err)
+	}
+	if n != 2 || len(got) != 2 || got[0] != "req2" || got[1] != "req3" {
+		t.Fatalf("replaySpool() replayed %d %v, want 2 [req2 req3]", n, got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("spool file still exists after full replay, Stat() error = %v", err)
+	}
+
+	// replaying a missing spool is not an error
+	n, err = replaySpool(context.Background(), path, insert)
+	if err != nil || n != 0 {
+		t.Errorf("replaySpool() on missing file = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func Test_replaySpool_Rejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.spool")
+	so := SpoolOpt{Enable: true, Path: path}
+
+	if err := spoolRecord(so, dbRecord{RequestID: "req1"}); err != nil {
+		t.Fatalf("spoolRecord() error = %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("os.OpenFile() error = %v", err)
+	}
+	f.WriteString("{not json\n")
+	f.Close()
+	for _, id := range []string{"req2", "req3"} {
+		if err := spoolRecord(so, dbRecord{RequestID: id}); err != nil {
+			t.Fatalf("spoolRecord() error = %v", err)
+		}
+	}
+
+	// req2 is rejected by the database and a record is spooled while
+	// the replay is running
+	var got []string
+	insert := func(ctx context.Context, r dbRecord) error {
+		if r.RequestID == "req2" {
+			return errors.Wrap(sqlStateError("22001"), "insert failed")
+		}
+		if r.RequestID == "req3" {
+			if err := spoolRecord(so, dbRecord{RequestID: "req4"}); err != nil {
+				t.Fatalf("spoolRecord() during replay error = %v", err)
+			}
+		}
+		got = append(got, r.RequestID)
+		return nil
+	}
+	n, err := replaySpool(context.Background(), path, insert)
+	if err != nil {
+		t.Fatalf("replaySpool() error = %v", err)
+	}
+	if n != 2 || len(got) != 2 || got[0] != "req1" || got[1] != "req3" {
+		t.Fatalf("replaySpool() replayed %d %v, want 2 [req1 req3]", n, got)
+	}
+
+	rejected, err := readSpool(path + ".rejected")
+	if err != nil {
+		t.Fatalf("readSpool(rejected) error = %v", err)
+	}
+	if len(rejected) != 2 || string(rejected[0]) != "{not json" {
+		t.Fatalf("rejected lines = %q, want the bad line and req2", rejected)
+	}
+	var r dbRecord
+	if err := json.Unmarshal(rejected[1], &r); err != nil || r.RequestID != "req2" {
+		t.Errorf("second rejected line = %s, want req2", rejected[1])
+	}
+
+	spooled, err := readSpool(path)
+	if err != nil {
+		t.Fatalf("readSpool() error = %v", err)
+	}
+	if len(spooled) != 1 || json.Unmarshal(spooled[0], &r) != nil || r.RequestID != "req4" {
+		t.Errorf("spool after replay = %q, want only req4", spooled)
+	}
+	if _, err := os.Stat(path + ".replay"); !os.IsNotExist(err) {
+		t.Errorf("snapshot file still exists after replay, Stat() error = %v", err)
+	}
+}
+
+// sqlStateError is a driver error carrying a Postgres SQLSTATE
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "pq: SQLSTATE " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func Test_rejectedDBError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"value too long", sqlStateError("22001"), true},
+		{"unique violation", errors.Wrap(sqlStateError("23505"), "insert"), true},
+		{"too many connections", sqlStateError("53300"), false},
+		{"cannot connect now", sqlStateError("57P03"), false},
+		{"admin shutdown", sqlStateError("57P01"), false},
+		{"connection failure", sqlStateError("08006"), false},
+		{"bad conn", driver.ErrBadConn, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"unknown", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := rejectedDBError(tt.err); got != tt.want {
+			t.Errorf("rejectedDBError(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package httplog
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gilcrest/httplog/errs"
+)
+
+// requestStateKey is the context key for the requestState of
+// each inbound request
+var requestStateKey = contextKey("RequestState")
+
+// requestState holds request details which handlers (or other
+// middleware) add while the request is being served. Context values
+// only flow down the handler chain, so the middleware sets a pointer
+// to the state into the context and reads it back once the handler
+// has returned. The mutex makes it safe to use from any goroutine
+// serving the request.
+type requestState struct {
+	mu     sync.Mutex
+	user   errs.UserName
+	phases []phase
+	fields []field
+}
+
+// stateFromContext returns the requestState set into ctx by the
+// middleware, or nil if there is none
+func stateFromContext(ctx context.Context) *requestState {
+	s, _ := ctx.Value(requestStateKey).(*requestState)
+	return s
+}
+
+// SetUser records u as the authenticated user for the request. It is
+// meant to be called by authentication middleware (or a handler)
+// running inside the httplog middleware. The user is written to the
+// response log and the user_name column of the audit table.
+//
+// The returned context also carries u for the errs package, so errors
+// built with errs.E(ctx, ...) have their User set; pass it on to the
+// next handler:
+//
+//	ctx := httplog.SetUser(req.Context(), errs.UserName("otto"))
+//	next.ServeHTTP(w, req.WithContext(ctx))
+func SetUser(ctx context.Context, u errs.UserName) context.Context {
+	if s := stateFromContext(ctx); s != nil {
+		s.mu.Lock()
+		s.user = u
+		s.mu.Unlock()
+	}
+	return errs.NewUserContext(ctx, u)
+}
+
+// User returns the authenticated user recorded with SetUser
+func (s *requestState) User() errs.UserName {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
@@ -0,0 +1,28 @@
+package httplog
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/gilcrest/httplog/errs"
+)
+
+func TestSetUser(t *testing.T) {
+	ctx, aud := newTestRequestContext(t, nil, zerolog.Nop())
+
+	// as called by authentication middleware inside httplog
+	ctx = SetUser(ctx, errs.UserName("otto"))
+
+	if got := aud.state.User(); got != "otto" {
+		t.Errorf("tracker user = %q, want otto", got)
+	}
+	if got := newDBRecord(zerolog.Nop(), aud, new(Opts)).UserName; got != "otto" {
+		t.Errorf("dbRecord UserName = %q, want otto", got)
+	}
+
+	err := errs.E(ctx, errs.Validation, "bad input")
+	if e, ok := err.(*errs.Error); !ok || e.User != "otto" {
+		t.Errorf("errs.E(ctx) User = %v, want otto", err)
+	}
+}
@@ -0,0 +1,336 @@
+package httplog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// syslogSDID is the SD-ID of the structured data element holding
+// the httplog fields. 32473 is the private enterprise number
+// reserved for documentation (RFC 5612)
+const syslogSDID = "httplog@32473"
+
+// syslogFacilities maps facility names to their RFC 5424 codes
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverity maps a zerolog level to an RFC 5424 severity
+func syslogSeverity(l zerolog.Level) int {
+	switch l {
+	case zerolog.PanicLevel:
+		return 0 // Emergency
+	case zerolog.FatalLevel:
+		return 2 // Critical
+	case zerolog.ErrorLevel:
+		return 3 // Error
+	case zerolog.WarnLevel:
+		return 4 // Warning
+	case zerolog.InfoLevel:
+		return 6 // Informational
+	case zerolog.DebugLevel, zerolog.TraceLevel:
+		return 7 // Debug
+	default:
+		return 5 // Notice
+	}
+}
+
+const (
+	// syslogDialTimeout bounds the time taken to connect to the
+	// syslog server
+	syslogDialTimeout = 5 * time.Second
+
+	// syslogWriteTimeout bounds the time taken to write a single
+	// message, so a stalled server cannot block the sender forever
+	syslogWriteTimeout = 2 * time.Second
+
+	// syslogQueueSize is the number of messages that can be waiting
+	// to be sent. Messages logged while the queue is full are dropped
+	syslogQueueSize = 1024
+)
+
+// syslogSinks holds the open syslog connections, keyed by SyslogOpt
+var (
+	syslogSinksMu sync.Mutex
+	syslogSinks   = make(map[SyslogOpt]*syslogSink)
+)
+
+// syslogLogger returns a zerolog.Logger which sends each event to
+// the syslog server described by so. msgID is used as the RFC 5424
+// MSGID of each message
+func syslogLogger(so SyslogOpt, msgID string) (zerolog.Logger, error) {
+	syslogSinksMu.Lock()
+	defer syslogSinksMu.Unlock()
+
+	s, ok := syslogSinks[so]
+	if !ok {
+		var err error
+		s, err = newSyslogSink(so)
+		if err != nil {
+			return zerolog.Nop(), err
+		}
+		syslogSinks[so] = s
+	}
+
+	w := syslogLevelWriter{sink: s, msgID: msgID}
+
+	return zerolog.New(w).Level(zerolog.InfoLevel).With().Timestamp().Logger(), nil
+}
+
+// syslogSink formats and sends RFC 5424 messages over a single,
+// lazily (re)dialed connection. Messages are queued and sent by a
+// background goroutine, so a slow or unreachable syslog server never
+// holds up the request being logged
+type syslogSink struct {
+	network  string
+	address  string
+	tlsCfg   *tls.Config
+	facility int
+	hostname string
+	appName  string
+	procID   string
+
+	queue chan []byte
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream bool
+}
+
+func newSyslogSink(so SyslogOpt) (*syslogSink, error) {
+	s := &syslogSink{
+		network: so.Network,
+		address: so.Address,
+		appName: so.AppName,
+		procID:  strconv.Itoa(os.Getpid()),
+		queue:   make(chan []byte, syslogQueueSize),
+	}
+
+	switch s.network {
+	case "udp", "tcp", "tls", "unix":
+	default:
+		return nil, errors.Errorf("unsupported syslog network %q", so.Network)
+	}
+	if s.address == "" {
+		return nil, errors.New("syslog address is empty")
+	}
+
+	s.facility = syslogFacilities["user"]
+	if so.Facility != "" {
+		f, ok := syslogFacilities[so.Facility]
+		if !ok {
+			return nil, errors.Errorf("unknown syslog facility %q", so.Facility)
+		}
+		s.facility = f
+	}
+
+	if s.appName == "" {
+		s.appName = "httplog"
+	}
+
+	s.hostname, _ = os.Hostname()
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+
+	if s.network == "tls" {
+		s.tlsCfg = &tls.Config{}
+		if so.TLSCAFile != "" {
+			pem, err := os.ReadFile(so.TLSCAFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.Errorf("no certificates found in %s", so.TLSCAFile)
+			}
+			s.tlsCfg.RootCAs = pool
+		}
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// run sends the queued messages. A message that cannot be sent is
+// logged and dropped
+func (s *syslogSink) run() {
+	for msg := range s.queue {
+		if err := s.send(msg); err != nil {
+			log.Warn().Err(err).Str("address", s.address).Msg("syslog message dropped")
+		}
+	}
+}
+
+// enqueue queues msg to be sent, without blocking. It returns an
+// error if the queue is full and msg has been dropped
+func (s *syslogSink) enqueue(msg []byte) error {
+	select {
+	case s.queue <- msg:
+		return nil
+	default:
+		return errors.Errorf("syslog queue for %s is full, message dropped", s.address)
+	}
+}
+
+// dial connects to the syslog server. For unix sockets a datagram
+// socket is tried first (as used by /dev/log) and a stream socket
+// second. s.mu must be held
+func (s *syslogSink) dial() error {
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	switch s.network {
+	case "udp":
+		conn, err = net.DialTimeout("udp", s.address, syslogDialTimeout)
+	case "tcp":
+		conn, err = net.DialTimeout("tcp", s.address, syslogDialTimeout)
+		s.stream = true
+	case "tls":
+		d := &net.Dialer{Timeout: syslogDialTimeout}
+		conn, err = tls.DialWithDialer(d, "tcp", s.address, s.tlsCfg)
+		s.stream = true
+	case "unix":
+		conn, err = net.DialTimeout("unixgram", s.address, syslogDialTimeout)
+		s.stream = false
+		if err != nil {
+			conn, err = net.DialTimeout("unix", s.address, syslogDialTimeout)
+			s.stream = true
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	return nil
+}
+
+// format returns an RFC 5424 message. requestID, if present, is
+// sent as a structured data parameter
+func (s *syslogSink) format(sev int, t time.Time, msgID, requestID string, msg []byte) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ",
+		s.facility*8+sev,
+		t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		s.appName,
+		s.procID,
+		msgID)
+
+	if requestID == "" {
+		b.WriteString("-")
+	} else {
+		fmt.Fprintf(&b, `[%s request_id="%s"]`, syslogSDID, sdEscape(requestID))
+	}
+
+	b.WriteByte(' ')
+	b.Write(bytes.TrimRight(msg, "\n"))
+
+	return b.Bytes()
+}
+
+// send writes a message, using octet counting framing (RFC 6587)
+// for stream connections. Each write has a deadline of
+// syslogWriteTimeout. If the write fails the connection is redialed
+// and the write tried once more
+func (s *syslogSink) send(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.conn == nil {
+			if err = s.dial(); err != nil {
+				continue
+			}
+		}
+
+		frame := msg
+		if s.stream {
+			frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err = s.conn.Write(frame); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	return err
+}
+
+// sdEscape escapes the characters that must be escaped in an
+// RFC 5424 structured data parameter value
+func sdEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// syslogLevelWriter satisfies zerolog.LevelWriter, sending each
+// JSON event written by zerolog to the syslog sink with the severity
+// matching the event level
+type syslogLevelWriter struct {
+	sink  *syslogSink
+	msgID string
+}
+
+// Write sends p with the Notice severity, it is only used by
+// zerolog for events written without a level
+func (w syslogLevelWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel queues p to be sent as the MSG part of a syslog
+// message. The request_id field of the event, if any, is also sent
+// as structured data
+func (w syslogLevelWriter) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	var ev struct {
+		RequestID string `json:"request_id"`
+	}
+	json.Unmarshal(p, &ev)
+
+	msg := w.sink.format(syslogSeverity(l), time.Now(), w.msgID, ev.RequestID, p)
+	if err := w.sink.enqueue(msg); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
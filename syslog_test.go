@@ -0,0 +1,112 @@
+package httplog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc5424 matches the header and structured data of a message
+// sent by syslogSink
+var rfc5424 = regexp.MustCompile(`^<(\d+)>1 \S+ \S+ myapp \d+ request \[httplog@32473 request_id="abc123"\] \{.*"message":"Request Received"\}$`)
+
+func Test_syslogLogger_udp(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	so := SyslogOpt{Network: "udp", Address: pc.LocalAddr().String(), Facility: "local0", AppName: "myapp"}
+	lgr, err := syslogLogger(so, "request")
+	if err != nil {
+		t.Fatalf("syslogLogger() error = %v", err)
+	}
+	lgr.Info().Str("request_id", "abc123").Msg("Request Received")
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+
+	m := rfc5424.FindStringSubmatch(string(buf[:n]))
+	if m == nil {
+		t.Fatalf("message does not match RFC 5424 format: %s", buf[:n])
+	}
+	// local0 (16) * 8 + Informational (6)
+	if m[1] != "134" {
+		t.Errorf("PRI = %s, want 134", m[1])
+	}
+}
+
+func Test_syslogLogger_tcp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		// octet counting framing: MSG-LEN SP SYSLOG-MSG
+		r := bufio.NewReader(conn)
+		l, err := r.ReadString(' ')
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(l))
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			got <- err.Error()
+			return
+		}
+		got <- string(msg)
+	}()
+
+	so := SyslogOpt{Network: "tcp", Address: ln.Addr().String(), AppName: "myapp"}
+	lgr, err := syslogLogger(so, "request")
+	if err != nil {
+		t.Fatalf("syslogLogger() error = %v", err)
+	}
+	lgr.Error().Str("request_id", "abc123").Msg("Request Received")
+
+	msg := <-got
+	m := rfc5424.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("message does not match RFC 5424 format: %s", msg)
+	}
+	// user (1) * 8 + Error (3)
+	if m[1] != "11" {
+		t.Errorf("PRI = %s, want 11", m[1])
+	}
+}
+
+func Test_syslogSink_enqueueFull(t *testing.T) {
+	s := &syslogSink{address: "127.0.0.1:514", queue: make(chan []byte, 1)}
+	if err := s.enqueue([]byte("first")); err != nil {
+		t.Fatalf("enqueue() error = %v", err)
+	}
+	if err := s.enqueue([]byte("second")); err == nil {
+		t.Error("enqueue() on a full queue error = nil, want error")
+	}
+}
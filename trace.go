@@ -0,0 +1,34 @@
+package httplog
+
+import (
+	"net/http"
+	"strings"
+)
+
+// traceIDs returns the trace and span ids sent by the caller, if any.
+// The W3C traceparent header is checked first, then the Google Cloud
+// X-Cloud-Trace-Context header
+func traceIDs(h http.Header) (traceID string, spanID string) {
+	// traceparent: version-traceid-parentid-flags
+	// e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	if tp := h.Get("traceparent"); tp != "" {
+		parts := strings.Split(tp, "-")
+		if len(parts) >= 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+			return parts[1], parts[2]
+		}
+	}
+
+	// X-Cloud-Trace-Context: TRACE_ID/SPAN_ID;o=TRACE_TRUE
+	if ct := h.Get("X-Cloud-Trace-Context"); ct != "" {
+		if i := strings.Index(ct, ";"); i >= 0 {
+			ct = ct[:i]
+		}
+		traceID = ct
+		if i := strings.Index(ct, "/"); i >= 0 {
+			traceID, spanID = ct[:i], ct[i+1:]
+		}
+		return traceID, spanID
+	}
+
+	return "", ""
+}
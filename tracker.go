@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog"
 )
@@ -15,11 +16,17 @@ import (
 // for auditing an http request
 type tracker struct {
 	requestID    string
+	traceID      string
+	spanID       string
 	clientID     string
 	timeStarted  time.Time
 	timeFinished time.Time
 	duration     time.Duration
+	latency      latency
 	responseCode int
+	// state holds the details added by handlers while
+	// the request is served, e.g. the authenticated user
+	state *requestState
 	request
 	response request
 }
@@ -42,25 +49,25 @@ type request struct {
 	close            bool
 	trailer          string
 	remoteAddr       string
+	clientIP         string
+	forwardedProto   string
+	forwardedHost    string
 	requestURI       string
-}
-
-// sets the start time in the APIAudit object
-func (t *tracker) startTimer() {
-	// set APIAudit TimeStarted to current time in UTC
-	loc, _ := time.LoadLocation("UTC")
-	t.timeStarted = time.Now().In(loc)
+	userAgent        string
+	// ua is the parsed userAgent, nil unless Opts.ParseUserAgent is set
+	ua *UserAgent
 }
 
 // stopTimer sets the stop time in the APIAudit object and
 // subtracts the stop time from the start time to determine the
 // service execution duration as this is after the response
-// has been written and sent
+// has been written and sent. The duration uses the monotonic clock
+// reading kept in latency.received, and the stop time is derived
+// from it, so timeFinished - timeStarted always equals duration
 func (t *tracker) stopTimer() {
-	loc, _ := time.LoadLocation("UTC")
-	t.timeFinished = time.Now().In(loc)
-	duration := t.timeFinished.Sub(t.timeStarted)
-	t.duration = duration
+	t.latency.written = time.Since(t.latency.received)
+	t.duration = t.latency.written
+	t.timeFinished = t.timeStarted.Add(t.duration)
 }
 
 // setResponse sets the response elements of the APIAudit payload
@@ -90,15 +97,21 @@ func (t *tracker) setResponse(log zerolog.Logger, rec *httptest.ResponseRecorder
 	return nil
 }
 
-// splitRequest populates the APIAudit struct being passed
-// as well as adds multiple request fields to the context
-func newAPIAudit(ctx context.Context, log zerolog.Logger, req *http.Request) (context.Context, *tracker, error) {
+// newAPIAudit creates a tracker populated from the request
+func newAPIAudit(ctx context.Context, log zerolog.Logger, req *http.Request, opts *Opts, trusted []*net.IPNet) (context.Context, *tracker, error) {
 
 	var (
 		scheme string
 	)
 
 	t := new(tracker)
+	t.state = new(requestState)
+	// a single instant is used for the start of the request: it is
+	// kept with its monotonic clock reading for measuring latency,
+	// and converted to UTC (which strips that reading) for logging
+	start := time.Now()
+	t.latency.received = start
+	t.timeStarted = start.UTC()
 
 	// split host and port out for cleaner logging
 	host, port, err := net.SplitHostPort(req.Host)
@@ -130,20 +143,22 @@ func newAPIAudit(ctx context.Context, log zerolog.Logger, req *http.Request) (co
 		return ctx, nil, err
 	}
 
+	bodyStart := time.Now()
 	body, err := dumpBody(req)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return ctx, nil, err
 	}
+	t.latency.bodyRead = time.Since(bodyStart)
 
-	// Sets a Unique ID into the context
-	ctx = setRequestID(ctx)
-	id, err := RequestID(ctx)
-	if err != nil {
-		log.Error().Err(err).Msg("")
-		return ctx, nil, err
-	}
-	t.requestID = id
+	// resolve the real client IP, believing forwarding headers
+	// only when sent by a trusted proxy
+	fwd := resolveForwarded(req, trusted)
+
+	// Generate a Unique ID for the request, it is set into the
+	// context with the other request elements by setRequest2Context
+	t.requestID = newRequestID()
+	t.traceID, t.spanID = traceIDs(req.Header)
 	t.request.proto = req.Proto
 	t.request.protoMajor = req.ProtoMajor
 	t.request.protoMinor = req.ProtoMinor
@@ -161,7 +176,30 @@ func newAPIAudit(ctx context.Context, log zerolog.Logger, req *http.Request) (co
 	t.request.close = req.Close
 	t.request.trailer = trailerJSON
 	t.request.remoteAddr = req.RemoteAddr
+	t.request.clientIP = fwd.clientIP
+	t.request.forwardedProto = fwd.proto
+	t.request.forwardedHost = fwd.host
 	t.request.requestURI = req.RequestURI
+	t.request.userAgent = req.UserAgent()
+	if opts != nil && opts.ParseUserAgent {
+		ua := ParseUserAgent(t.request.userAgent)
+		t.request.ua = &ua
+	}
+
+	// resolve the client id, if a ClientIdentifier has been set.
+	// A failure to identify the client is logged, but does not
+	// stop the request
+	if opts != nil && opts.ClientIdentifier != nil {
+		cid, err := opts.ClientIdentifier.ClientID(req)
+		if err != nil {
+			log.Warn().Err(err).Str("request_id", t.requestID).Msg("unable to identify client")
+		}
+		if n := utf8.RuneCountInString(cid); n > maxClientIDLen {
+			log.Warn().Str("request_id", t.requestID).Int("length", n).Msg("client id too long, ignored")
+			cid = ""
+		}
+		t.clientID = cid
+	}
 
 	return ctx, t, nil
 }
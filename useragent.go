@@ -0,0 +1,232 @@
+package httplog
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+)
+
+// Device classes set in UserAgent.Device
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+)
+
+// UserAgent holds the structured fields parsed from a User-Agent
+// header by ParseUserAgent
+type UserAgent struct {
+	// Name is the browser or client name, e.g. Chrome, curl, Googlebot
+	Name string
+	// Version is the browser or client version
+	Version string
+	// OS is the operating system name, e.g. Windows, macOS, Android
+	OS string
+	// OSVersion is the operating system version
+	OSVersion string
+	// Device is the device class: desktop, mobile, tablet, bot or other
+	Device string
+	// Bot is true for crawlers, spiders and other automated agents
+	Bot bool
+}
+
+// uaRule matches a User-Agent header to a client name. The first
+// submatch of re, if any, is the version
+type uaRule struct {
+	re   *regexp.Regexp
+	name string
+}
+
+// uaBotRe matches the tokens of crawlers, spiders and other
+// automated agents. It is checked on its own rather than as part of
+// uaRules, as many bots (e.g. GPTBot, PetalBot) also claim to be
+// Chrome or Safari and would otherwise be named as a browser and
+// not flagged
+var uaBotRe = regexp.MustCompile(`(?i)bot\b|crawler|spider|scraper|slurp|facebookexternalhit|HeadlessChrome`)
+
+// uaRules are tried in order and the first match wins, so more
+// specific rules (e.g. Edge, which also claims to be Chrome and
+// Safari) must come before the more general ones
+var uaRules = []uaRule{
+	// bots
+	{regexp.MustCompile(`Googlebot(?:-\w+)?/([\d.]+)`), "Googlebot"},
+	{regexp.MustCompile(`bingbot/([\d.]+)`), "Bingbot"},
+	{regexp.MustCompile(`DuckDuckBot(?:-\w+)?/([\d.]+)`), "DuckDuckBot"},
+	{regexp.MustCompile(`Baiduspider(?:-\w+)?/([\d.]+)`), "Baiduspider"},
+	{regexp.MustCompile(`YandexBot/([\d.]+)`), "YandexBot"},
+	{regexp.MustCompile(`Applebot/([\d.]+)`), "Applebot"},
+	{regexp.MustCompile(`Yahoo! Slurp`), "Yahoo! Slurp"},
+	{regexp.MustCompile(`facebookexternalhit/([\d.]+)`), "Facebook"},
+	{regexp.MustCompile(`Twitterbot/([\d.]+)`), "Twitterbot"},
+	{regexp.MustCompile(`LinkedInBot/([\d.]+)`), "LinkedInBot"},
+	{regexp.MustCompile(`Slackbot(?:-\w+)?(?: ([\d.]+))?`), "Slackbot"},
+	{regexp.MustCompile(`AhrefsBot/([\d.]+)`), "AhrefsBot"},
+	{regexp.MustCompile(`SemrushBot(?:/([\d.~\w]+))?`), "SemrushBot"},
+	{regexp.MustCompile(`HeadlessChrome/([\d.]+)`), "HeadlessChrome"},
+
+	// browsers
+	{regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`), "Edge"},
+	{regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`), "Opera"},
+	{regexp.MustCompile(`SamsungBrowser/([\d.]+)`), "Samsung Internet"},
+	{regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`), "Firefox"},
+	{regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`), "Chrome"},
+	{regexp.MustCompile(`Version/([\d.]+).*Safari/`), "Safari"},
+	{regexp.MustCompile(`MSIE ([\d.]+)`), "Internet Explorer"},
+	{regexp.MustCompile(`Trident/.*rv:([\d.]+)`), "Internet Explorer"},
+
+	// HTTP clients and tools
+	{regexp.MustCompile(`^curl/([\d.]+)`), "curl"},
+	{regexp.MustCompile(`^Wget/([\d.]+)`), "Wget"},
+	{regexp.MustCompile(`^PostmanRuntime/([\d.]+)`), "Postman"},
+	{regexp.MustCompile(`^insomnia/([\d.]+)`), "Insomnia"},
+	{regexp.MustCompile(`^python-requests/([\d.]+)`), "python-requests"},
+	{regexp.MustCompile(`^Python-urllib/([\d.]+)`), "Python-urllib"},
+	{regexp.MustCompile(`^Go-http-client/([\d.]+)`), "Go-http-client"},
+	{regexp.MustCompile(`^okhttp/([\d.]+)`), "okhttp"},
+	{regexp.MustCompile(`^axios/([\d.]+)`), "axios"},
+	{regexp.MustCompile(`^node-fetch(?:/([\d.]+))?`), "node-fetch"},
+	{regexp.MustCompile(`^Apache-HttpClient/([\d.]+)`), "Apache-HttpClient"},
+	{regexp.MustCompile(`^Java/([\d._]+)`), "Java"},
+
+	// anything else identifying itself as automated
+	{uaBotRe, "Bot"},
+}
+
+// uaOSRule matches a User-Agent header to an operating system. The
+// first submatch of re, if any, is the version
+type uaOSRule struct {
+	re *regexp.Regexp
+	os string
+}
+
+var uaOSRules = []uaOSRule{
+	{regexp.MustCompile(`Windows Phone(?: OS)? ([\d.]+)`), "Windows Phone"},
+	{regexp.MustCompile(`Windows NT ([\d.]+)`), "Windows"},
+	{regexp.MustCompile(`iPad.*OS ([\d_]+)`), "iPadOS"},
+	{regexp.MustCompile(`(?:iPhone|iPod).*OS ([\d_]+)`), "iOS"},
+	{regexp.MustCompile(`Android ([\d.]+)`), "Android"},
+	{regexp.MustCompile(`CrOS \S+ ([\d.]+)`), "ChromeOS"},
+	{regexp.MustCompile(`Mac OS X ([\d_.]+)`), "macOS"},
+	{regexp.MustCompile(`Linux`), "Linux"},
+}
+
+// windowsVersions maps Windows NT kernel versions to release names
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// Sizes of the ua_name, ua_version, ua_os and ua_os_version columns
+// of the audit_log table. The versions are taken from the client's
+// User-Agent header, so ParseUserAgent truncates each field to fit
+// rather than let an overlong header fail the audit insert
+const (
+	maxUANameLen      = 100
+	maxUAVersionLen   = 50
+	maxUAOSLen        = 100
+	maxUAOSVersionLen = 50
+)
+
+var (
+	uaTabletRe = regexp.MustCompile(`iPad|Tablet|Kindle|Silk/|PlayBook`)
+	uaMobileRe = regexp.MustCompile(`Mobi|iPhone|iPod|Android|Windows Phone`)
+)
+
+// ParseUserAgent parses a User-Agent header into its browser or
+// client, operating system and device class, and flags known bots.
+// Parsing uses a set of rules compiled into httplog; no lookups
+// are made. Fields that can't be determined are left empty, except
+// Device, which is set to "other". Name and OS are truncated to 100
+// characters and Version and OSVersion to 50, the sizes of their
+// audit_log columns.
+func ParseUserAgent(ua string) UserAgent {
+	var u UserAgent
+
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		u.Device = DeviceOther
+		return u
+	}
+
+	for _, r := range uaRules {
+		m := r.re.FindStringSubmatch(ua)
+		if m == nil {
+			continue
+		}
+		u.Name = r.name
+		if len(m) > 1 {
+			u.Version = m[1]
+		}
+		break
+	}
+	u.Bot = uaBotRe.MatchString(ua)
+
+	for _, r := range uaOSRules {
+		m := r.re.FindStringSubmatch(ua)
+		if m == nil {
+			continue
+		}
+		u.OS = r.os
+		if len(m) > 1 {
+			u.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+		}
+		break
+	}
+	if u.OS == "Windows" {
+		if v, ok := windowsVersions[u.OSVersion]; ok {
+			u.OSVersion = v
+		}
+	}
+
+	switch {
+	case u.Bot:
+		u.Device = DeviceBot
+	case uaTabletRe.MatchString(ua), u.OS == "Android" && !strings.Contains(ua, "Mobile"):
+		u.Device = DeviceTablet
+	case uaMobileRe.MatchString(ua):
+		u.Device = DeviceMobile
+	case u.OS == "Windows", u.OS == "macOS", u.OS == "Linux", u.OS == "ChromeOS":
+		u.Device = DeviceDesktop
+	default:
+		u.Device = DeviceOther
+	}
+
+	u.Name = truncate(u.Name, maxUANameLen)
+	u.Version = truncate(u.Version, maxUAVersionLen)
+	u.OS = truncate(u.OS, maxUAOSLen)
+	u.OSVersion = truncate(u.OSVersion, maxUAOSVersionLen)
+
+	return u
+}
+
+// truncate returns s cut to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// withUserAgent returns a child of log carrying the parsed
+// User-Agent fields, or log itself if ua is nil
+func withUserAgent(log zerolog.Logger, ua *UserAgent) zerolog.Logger {
+	if ua == nil {
+		return log
+	}
+	return log.With().
+		Str("ua_name", ua.Name).
+		Str("ua_version", ua.Version).
+		Str("ua_os", ua.OS).
+		Str("ua_os_version", ua.OSVersion).
+		Str("ua_device", ua.Device).
+		Bool("ua_bot", ua.Bot).
+		Logger()
+}
@@ -0,0 +1,61 @@
+package httplog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want UserAgent
+	}{
+		{"empty", "", UserAgent{Device: DeviceOther}},
+		{"chrome windows",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.71 Safari/537.36",
+			UserAgent{Name: "Chrome", Version: "94.0.4606.71", OS: "Windows", OSVersion: "10", Device: DeviceDesktop}},
+		{"edge",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.71 Safari/537.36 Edg/94.0.992.38",
+			UserAgent{Name: "Edge", Version: "94.0.992.38", OS: "Windows", OSVersion: "10", Device: DeviceDesktop}},
+		{"safari iphone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.0 Mobile/15E148 Safari/604.1",
+			UserAgent{Name: "Safari", Version: "15.0", OS: "iOS", OSVersion: "15.0", Device: DeviceMobile}},
+		{"safari ipad",
+			"Mozilla/5.0 (iPad; CPU OS 14_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.2 Mobile/15E148 Safari/604.1",
+			UserAgent{Name: "Safari", Version: "14.1.2", OS: "iPadOS", OSVersion: "14.7", Device: DeviceTablet}},
+		{"firefox mac",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:92.0) Gecko/20100101 Firefox/92.0",
+			UserAgent{Name: "Firefox", Version: "92.0", OS: "macOS", OSVersion: "10.15", Device: DeviceDesktop}},
+		{"chrome android phone",
+			"Mozilla/5.0 (Linux; Android 11; Pixel 5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.71 Mobile Safari/537.36",
+			UserAgent{Name: "Chrome", Version: "94.0.4606.71", OS: "Android", OSVersion: "11", Device: DeviceMobile}},
+		{"chrome android tablet",
+			"Mozilla/5.0 (Linux; Android 11; SM-T870) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.71 Safari/537.36",
+			UserAgent{Name: "Chrome", Version: "94.0.4606.71", OS: "Android", OSVersion: "11", Device: DeviceTablet}},
+		{"googlebot",
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgent{Name: "Googlebot", Version: "2.1", Device: DeviceBot, Bot: true}},
+		{"gptbot claiming chrome",
+			"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.2; +https://openai.com/gptbot) Chrome/119.0.0.0 Safari/537.36",
+			UserAgent{Name: "Chrome", Version: "119.0.0.0", Device: DeviceBot, Bot: true}},
+		{"petalbot claiming chrome android",
+			"Mozilla/5.0 (Linux; Android 7.0;) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/99.0.4844.88 Mobile Safari/537.36 (compatible; PetalBot;+https://webmaster.petalsearch.com/site/petalbot)",
+			UserAgent{Name: "Chrome", Version: "99.0.4844.88", OS: "Android", OSVersion: "7.0", Device: DeviceBot, Bot: true}},
+		{"generic crawler",
+			"ExampleCrawler/1.0 (+https://example.com/crawler)",
+			UserAgent{Name: "Bot", Device: DeviceBot, Bot: true}},
+		{"overlong versions",
+			"Mozilla/5.0 (Windows NT 10.0." + strings.Repeat("1", 60) + ") Chrome/111" + strings.Repeat("1", 60) + ".0 Safari/537.36",
+			UserAgent{Name: "Chrome", Version: "111" + strings.Repeat("1", 47), OS: "Windows", OSVersion: "10.0." + strings.Repeat("1", 45), Device: DeviceDesktop}},
+		{"curl", "curl/7.79.1", UserAgent{Name: "curl", Version: "7.79.1", Device: DeviceOther}},
+		{"go", "Go-http-client/1.1", UserAgent{Name: "Go-http-client", Version: "1.1", Device: DeviceOther}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseUserAgent(tt.ua); got != tt.want {
+				t.Errorf("ParseUserAgent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}